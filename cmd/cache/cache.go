@@ -0,0 +1,309 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+
+	cachepkg "github.com/mlowery/mcfetcher/pkg/cache"
+	"github.com/mlowery/mcfetcher/pkg/config"
+	oerrors "github.com/mlowery/mcfetcher/pkg/errors"
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+// shown for caches written before metadata was recorded
+const noneValue = "<none>"
+
+var Cmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and manage the cache files in the work dir.",
+}
+
+// entry is a cache file along with its metadata.
+type entry struct {
+	*cachepkg.Entry
+	// meta is nil if the cache has none
+	meta *cachepkg.Meta
+	info os.FileInfo
+}
+
+// fetchedAt is when the entry was written, falling back to the file's mtime if it has no metadata.
+func (e *entry) fetchedAt() time.Time {
+	if e.meta != nil {
+		return e.meta.FetchedAt
+	}
+	return e.info.ModTime()
+}
+
+var lsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List cache files with their served version, object counts, age, size, config hash, and cluster labels.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, dFunc := util.NewLogger()
+		defer dFunc()
+
+		store := newStore(logger)
+		entries := listOrDie(logger, cmd, store)
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "CONTEXT\tGVK\tVERSION\tOBJECTS\tAGE\tSIZE\tCONFIG\tLABELS")
+		for _, e := range entries {
+			version, count, configHash, labels := noneValue, noneValue, noneValue, noneValue
+			if e.meta != nil {
+				if len(e.meta.ServedVersion) > 0 {
+					version = e.meta.ServedVersion
+				}
+				count = fmt.Sprintf("%d", e.meta.Count)
+				if e.meta.Absent {
+					count = "absent"
+				}
+				if len(e.meta.ConfigHash) > 0 {
+					configHash = e.meta.ConfigHash
+				}
+				if len(e.meta.Labels) > 0 {
+					labels = k8slabels.Set(e.meta.Labels).String()
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", e.Context, e.GVK, version, count,
+				time.Since(e.fetchedAt()).Round(time.Second), e.info.Size(), configHash, labels)
+		}
+		w.Flush()
+	},
+}
+
+var showCmd = &cobra.Command{
+	Use:   "show <context> <gvk>",
+	Short: "Print the cached objects of one context and GVK.",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, dFunc := util.NewLogger()
+		defer dFunc()
+
+		output, _ := cmd.Flags().GetString("output")
+		if output != "yaml" && output != "json" {
+			logger.Errorf("unknown output %q: must be yaml or json", output)
+			os.Exit(util.ExitConfigError)
+		}
+
+		context, gvkString := args[0], args[1]
+		store := newStore(logger)
+		objs, err := store.Get(context, gvkString)
+		if err != nil {
+			logger.Fatalf("failed to read cached records: %v", err)
+		}
+		if objs == nil {
+			logger.Fatalf("nothing cached for context %q and gvk %q", context, gvkString)
+		}
+		var b []byte
+		if output == "json" {
+			b, err = json.MarshalIndent(objs, "", "  ")
+			b = append(b, '\n')
+		} else {
+			b, err = yaml.Marshal(objs)
+		}
+		if err != nil {
+			logger.Fatalf("failed to marshal objects: %v", err)
+		}
+		os.Stdout.Write(b)
+	},
+}
+
+var rmCmd = &cobra.Command{
+	Use:   "rm",
+	Short: "Delete cache files so that the next fetch lists them again.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, dFunc := util.NewLogger()
+		defer dFunc()
+
+		if err := checkRmSelection(cmd); err != nil {
+			logger.Errorf("%v", err)
+			os.Exit(util.ExitConfigError)
+		}
+		olderThan, _ := cmd.Flags().GetDuration("older-than")
+
+		store := newStore(logger)
+		unlock, err := util.LockWorkDir(store.Dir())
+		if err != nil {
+			logger.Fatalf("failed to lock work dir: %v", err)
+		}
+		defer unlock()
+
+		for _, e := range listOrDie(logger, cmd, store) {
+			if olderThan > 0 && time.Since(e.fetchedAt()) < olderThan {
+				continue
+			}
+			logger.Infow("removing", "context", e.Context, "gvk", e.GVK)
+			if err := store.Remove(e.Context, e.GVK); err != nil {
+				logger.Fatalf("failed to remove cache: %v", err)
+			}
+		}
+	},
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that each cache file parses and matches its metadata and the current config.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, dFunc := util.NewLogger()
+		defer dFunc()
+
+		// the config is optional; without it config hashes aren't compared
+		var gvkConfigs map[string]*config.GVK
+		if viper.IsSet("gvk") {
+			gvkConfigs = config.ReadGVKOrDie()
+		}
+
+		store := newStore(logger)
+		if code := verify(logger, store, listOrDie(logger, cmd, store), gvkConfigs); code != util.ExitOK {
+			os.Exit(code)
+		}
+	},
+}
+
+// checkRmSelection returns an error unless the flags of cmd select what rm removes, so that a bare rm doesn't remove
+// everything.
+func checkRmSelection(cmd *cobra.Command) error {
+	all, _ := cmd.Flags().GetBool("all")
+	olderThan, _ := cmd.Flags().GetDuration("older-than")
+	if !all && olderThan <= 0 && !cmd.Flags().Changed("context") && !cmd.Flags().Changed("gvk") {
+		return fmt.Errorf("one of all, context, gvk, or older-than is required")
+	}
+	return nil
+}
+
+// verify checks entries against their files, their metadata, and gvkConfigs if it is not nil. It returns the exit
+// code: unparsable files are errors and the rest are problems that re-fetching fixes.
+func verify(logger *zap.SugaredLogger, store *cachepkg.FileStore, entries []*entry,
+	gvkConfigs map[string]*config.GVK) int {
+	var problemCount, errorCount, parsedCount int
+	problem := func(e *entry, cause error, message string, keysAndValues ...interface{}) {
+		problemCount++
+		logger.Errorw(oerrors.New(cause, message,
+			append([]interface{}{"gvk", e.GVK, "context", e.Context}, keysAndValues...)...).Error())
+	}
+	for _, e := range entries {
+		objs, err := store.Get(e.Context, e.GVK)
+		if err != nil {
+			errorCount++
+			problem(e, err, "failed to parse")
+			continue
+		}
+		parsedCount++
+		if e.meta == nil {
+			problem(e, nil, "no metadata (re-fetch to record it)")
+			continue
+		}
+		if len(objs) != e.meta.Count {
+			problem(e, nil, "object count doesn't match metadata", "count", len(objs), "metaCount", e.meta.Count)
+		}
+		if gvkConfig, ok := gvkConfigs[e.GVK]; ok && gvkConfig.Hash != e.meta.ConfigHash {
+			problem(e, nil, "config changed since fetch", "configHash", gvkConfig.Hash, "metaConfigHash",
+				e.meta.ConfigHash)
+		}
+	}
+
+	if problemCount > 0 {
+		logger.Infof("found %d problems (written to stderr)", problemCount)
+	}
+	if errorCount > 0 {
+		if parsedCount == 0 {
+			return util.ExitFailure
+		}
+		return util.ExitPartialFailure
+	}
+	if problemCount > 0 {
+		return util.ExitDrift
+	}
+	return util.ExitOK
+}
+
+func newStore(logger *zap.SugaredLogger) *cachepkg.FileStore {
+	workDir, err := util.EnsureWorkDir()
+	if err != nil {
+		logger.Fatalf("failed to ensure work dir: %v", err)
+	}
+	return cachepkg.NewFileStore(workDir)
+}
+
+// listOrDie returns the entries selected by the --context and --gvk flags of cmd, sorted by GVK and context.
+func listOrDie(logger *zap.SugaredLogger, cmd *cobra.Command, store *cachepkg.FileStore) []*entry {
+	contexts, _ := cmd.Flags().GetStringSlice("context")
+	gvks, _ := cmd.Flags().GetStringSlice("gvk")
+	cacheEntries, err := store.List()
+	if err != nil {
+		logger.Fatalf("failed to list cache: %v", err)
+	}
+	var entries []*entry
+	for _, ce := range cacheEntries {
+		if !selected(ce.Context, contexts) || !selected(ce.GVK, gvks) {
+			continue
+		}
+		info, err := os.Stat(ce.Path)
+		if err != nil {
+			logger.Fatalf("failed to stat %q: %v", ce.Path, err)
+		}
+		meta, err := store.GetMeta(ce.Context, ce.GVK)
+		if err != nil {
+			logger.Fatalf("failed to read metadata: %v", err)
+		}
+		entries = append(entries, &entry{Entry: ce, meta: meta, info: info})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].GVK != entries[j].GVK {
+			return entries[i].GVK < entries[j].GVK
+		}
+		return entries[i].Context < entries[j].Context
+	})
+	return entries
+}
+
+// selected returns true if filter is empty or contains s.
+func selected(s string, filter []string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, f := range filter {
+		if f == s {
+			return true
+		}
+	}
+	return false
+}
+
+// addSelectorFlags adds the --context and --gvk flags read by listOrDie to c.
+func addSelectorFlags(c *cobra.Command) {
+	c.Flags().StringSlice("context", nil, "only these contexts")
+	c.Flags().StringSlice("gvk", nil, "only these GVKs")
+}
+
+// addRmFlags adds the flags of rm other than the selector flags to c.
+func addRmFlags(c *cobra.Command) {
+	c.Flags().Duration("older-than", 0, "only caches fetched longer ago than this")
+	c.Flags().Bool("all", false, "remove every cache file")
+}
+
+func init() {
+	// flags are read from the commands instead of viper since names like older-than are already bound to other
+	// commands
+	for _, c := range []*cobra.Command{lsCmd, rmCmd, verifyCmd} {
+		addSelectorFlags(c)
+	}
+	showCmd.Flags().StringP("output", "o", "yaml", "output format: yaml or json")
+	addRmFlags(rmCmd)
+
+	Cmd.AddCommand(lsCmd)
+	Cmd.AddCommand(showCmd)
+	Cmd.AddCommand(rmCmd)
+	Cmd.AddCommand(verifyCmd)
+}
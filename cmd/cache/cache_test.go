@@ -0,0 +1,174 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	cachepkg "github.com/mlowery/mcfetcher/pkg/cache"
+	"github.com/mlowery/mcfetcher/pkg/config"
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+// newTestStore returns a store with one object cached for each of c1 and c2 and namespace. and configmap. with
+// config hash h.
+func newTestStore(t *testing.T) (*cachepkg.FileStore, func()) {
+	dir, err := ioutil.TempDir("", "mcfetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := cachepkg.NewFileStore(dir)
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("Namespace")
+	obj.SetName("a")
+	for _, context := range []string{"c1", "c2"} {
+		for _, gvkString := range []string{"namespace.", "configmap."} {
+			err := store.Put(context, gvkString, []*unstructured.Unstructured{obj}, &cachepkg.Meta{ConfigHash: "h"})
+			if err != nil {
+				os.RemoveAll(dir)
+				t.Fatal(err)
+			}
+		}
+	}
+	return store, func() { os.RemoveAll(dir) }
+}
+
+// newTestCmd returns a command with the flags of rm parsed from args.
+func newTestCmd(t *testing.T, args ...string) *cobra.Command {
+	c := &cobra.Command{}
+	addSelectorFlags(c)
+	addRmFlags(c)
+	if err := c.Flags().Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func Test_listOrDie(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "all", want: []string{"configmap./c1", "configmap./c2", "namespace./c1", "namespace./c2"}},
+		{name: "context", args: []string{"--context=c2"}, want: []string{"configmap./c2", "namespace./c2"}},
+		{name: "gvk", args: []string{"--gvk=namespace."}, want: []string{"namespace./c1", "namespace./c2"}},
+		{name: "both", args: []string{"--context=c1,c3", "--gvk=configmap."}, want: []string{"configmap./c1"}},
+		{name: "none", args: []string{"--context=c3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, e := range listOrDie(zap.NewNop().Sugar(), newTestCmd(t, tt.args...), store) {
+				got = append(got, e.GVK+"/"+e.Context)
+				if e.meta == nil || e.meta.ConfigHash != "h" {
+					t.Errorf("meta of %s/%s = %+v, want config hash h", e.GVK, e.Context, e.meta)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listOrDie() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_checkRmSelection(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr bool
+	}{
+		{args: nil, wantErr: true},
+		{args: []string{"--all"}},
+		{args: []string{"--all=false"}, wantErr: true},
+		{args: []string{"--older-than=24h"}},
+		{args: []string{"--older-than=0s"}, wantErr: true},
+		{args: []string{"--context=c1"}},
+		{args: []string{"--gvk=namespace."}},
+	}
+	for _, tt := range tests {
+		if err := checkRmSelection(newTestCmd(t, tt.args...)); (err != nil) != tt.wantErr {
+			t.Errorf("checkRmSelection(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+		}
+	}
+}
+
+func Test_verify(t *testing.T) {
+	tests := []struct {
+		name string
+		// change is applied to the entries and their files before verifying
+		change     func(t *testing.T, entries []*entry)
+		gvkConfigs map[string]*config.GVK
+		want       int
+	}{
+		{name: "ok", want: util.ExitOK},
+		{
+			name:       "config unchanged",
+			gvkConfigs: map[string]*config.GVK{"namespace.": {Hash: "h"}},
+			want:       util.ExitOK,
+		},
+		{
+			name:       "config changed",
+			gvkConfigs: map[string]*config.GVK{"namespace.": {Hash: "other"}},
+			want:       util.ExitDrift,
+		},
+		{
+			name: "count mismatch",
+			change: func(t *testing.T, entries []*entry) {
+				entries[0].meta.Count = 2
+			},
+			want: util.ExitDrift,
+		},
+		{
+			name: "no metadata",
+			change: func(t *testing.T, entries []*entry) {
+				entries[0].meta = nil
+			},
+			want: util.ExitDrift,
+		},
+		{
+			name: "some unparsable",
+			change: func(t *testing.T, entries []*entry) {
+				corrupt(t, entries[0])
+			},
+			want: util.ExitPartialFailure,
+		},
+		{
+			name: "all unparsable",
+			change: func(t *testing.T, entries []*entry) {
+				for _, e := range entries {
+					corrupt(t, e)
+				}
+			},
+			want: util.ExitFailure,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, cleanup := newTestStore(t)
+			defer cleanup()
+			logger := zap.NewNop().Sugar()
+			entries := listOrDie(logger, newTestCmd(t), store)
+			if tt.change != nil {
+				tt.change(t, entries)
+			}
+			if got := verify(logger, store, entries, tt.gvkConfigs); got != tt.want {
+				t.Errorf("verify() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func corrupt(t *testing.T, e *entry) {
+	if err := ioutil.WriteFile(e.Path, []byte("[{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
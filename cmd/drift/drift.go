@@ -0,0 +1,148 @@
+package drift
+
+import (
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/mlowery/mcfetcher/pkg/cache"
+	"github.com/mlowery/mcfetcher/pkg/config"
+	oerrors "github.com/mlowery/mcfetcher/pkg/errors"
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "drift",
+	Short: "Compare golden manifests against the sanitized cache of each context.",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, dFunc := util.NewLogger()
+		defer dFunc()
+		defer func(start time.Time) {
+			logger.Infow("done", "totalDuration", time.Since(start))
+		}(time.Now())
+
+		gvkConfigs := config.ReadGVKOrDie()
+		contexts := config.ClusterNames(config.ReadClustersOrDie())
+		manifestsDir := config.ReadString("manifests", "")
+		if len(manifestsDir) == 0 {
+			logger.Errorf("manifests is required")
+			os.Exit(util.ExitConfigError)
+		}
+
+		workDir, err := util.EnsureWorkDir()
+		if err != nil {
+			logger.Fatalf("failed to ensure work dir: %v", err)
+		}
+		store := cache.NewFileStore(workDir)
+
+		manifests, err := util.ReadManifests(manifestsDir)
+		if err != nil {
+			logger.Fatalf("failed to read manifests: %v", err)
+		}
+		logger.Infow("read manifests", "dir", manifestsDir, "objCount", len(manifests))
+
+		if code := compare(logger, store, manifests, gvkConfigs, contexts); code != util.ExitOK {
+			os.Exit(code)
+		}
+	},
+}
+
+// compare compares the manifests matched by each GVK in gvkConfigs against what store has cached for each of contexts
+// and returns the exit code.
+func compare(logger *zap.SugaredLogger, store cache.Store, manifests []*unstructured.Unstructured,
+	gvkConfigs map[string]*config.GVK, contexts []string) int {
+	var errorCount, comparedCount, driftCount int
+	for gvkString, gvkConfig := range gvkConfigs {
+		logger := logger.With("gvk", gvkString)
+		sanitizeLogger := logger.Named(util.ComponentSanitize)
+		var want []*unstructured.Unstructured
+		for _, obj := range manifests {
+			if !gvkConfig.Matches(obj.GroupVersionKind()) {
+				continue
+			}
+			sanObj, err := util.Sanitize(sanitizeLogger, obj, gvkConfig.IgnoreNames, gvkConfig.PathValueFilters,
+				gvkConfig.KeepAnnotations, gvkConfig.IgnoreAnnotations, gvkConfig.KeepLabels, gvkConfig.IgnoreLabels,
+				gvkConfig.KeepPaths, gvkConfig.IgnorePaths, gvkConfig.KeepDeleted)
+			if err != nil {
+				errorCount++
+				logger.Errorw(oerrors.New(err, "failed to sanitize manifest",
+					"gvk", gvkString, "name", obj.GetName()).Error())
+				continue
+			}
+			if sanObj != nil {
+				want = append(want, sanObj)
+			}
+		}
+
+		for _, context := range contexts {
+			logger := logger.With("context", context)
+			got, err := store.Get(context, gvkString)
+			if err != nil {
+				errorCount++
+				logger.Errorw(oerrors.New(err, "failed to read cached records",
+					"gvk", gvkString, "context", context).Error())
+				continue
+			}
+			if got == nil {
+				errorCount++
+				logger.Errorw(oerrors.New(nil, "no cached records (run fetch first)",
+					"gvk", gvkString, "context", context).Error())
+				continue
+			}
+			meta, err := store.GetMeta(context, gvkString)
+			if err != nil {
+				errorCount++
+				logger.Errorw(oerrors.New(err, "failed to read cached records",
+					"gvk", gvkString, "context", context).Error())
+				continue
+			}
+			comparedCount++
+			if meta != nil && meta.Absent {
+				// nothing to compare; every wanted object is missing because the cluster doesn't serve the GVK
+				if len(want) > 0 {
+					logger.Infow("drift", "type", "not-served", "missingCount", len(want))
+					driftCount += len(want)
+				}
+				continue
+			}
+			d := util.DiffObjects(want, got)
+			for _, key := range d.Missing {
+				logger.Infow("drift", "type", "missing", "key", key)
+			}
+			for _, key := range d.Extra {
+				logger.Infow("drift", "type", "extra", "key", key)
+			}
+			for key, paths := range d.Differing {
+				logger.Infow("drift", "type", "differing", "key", key, "paths", paths)
+			}
+			// not drift by itself: the fields both versions have are compared above
+			for key, m := range d.VersionMismatch {
+				logger.Infow("version-mismatch", "key", key, "wantVersion", m.Want, "servedVersion", m.Got)
+			}
+			driftCount += len(d.Missing) + len(d.Extra) + len(d.Differing)
+		}
+	}
+
+	// errors win over drift since drift can't be trusted if some comparisons are missing
+	if errorCount > 0 {
+		logger.Infof("failed with %d errors (written to stderr)", errorCount)
+		if comparedCount == 0 {
+			return util.ExitFailure
+		}
+		return util.ExitPartialFailure
+	}
+	if driftCount > 0 {
+		logger.Infof("found %d drifted objects", driftCount)
+		return util.ExitDrift
+	}
+	return util.ExitOK
+}
+
+func init() {
+	Cmd.Flags().String("manifests", "", "directory of golden YAML/JSON manifests")
+	viper.BindPFlag("manifests", Cmd.Flags().Lookup("manifests"))
+}
@@ -0,0 +1,118 @@
+package drift
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/mlowery/mcfetcher/pkg/cache"
+	"github.com/mlowery/mcfetcher/pkg/config"
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+func newObj(kind, name string, labels map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetAPIVersion("v1")
+	obj.SetKind(kind)
+	obj.SetName(name)
+	obj.SetLabels(labels)
+	return obj
+}
+
+func Test_compare(t *testing.T) {
+	gvkConfigs := map[string]*config.GVK{
+		"namespace.": {GroupVersionKind: schema.GroupVersionKind{Kind: "Namespace"}},
+	}
+	// the config map matches no configured GVK so it is never reported
+	manifests := []*unstructured.Unstructured{
+		newObj("Namespace", "a", nil),
+		newObj("Namespace", "b", nil),
+		newObj("ConfigMap", "a", nil),
+	}
+	tests := []struct {
+		name string
+		// cached maps contexts to their cached objects; contexts without an entry have nothing cached
+		cached map[string][]*unstructured.Unstructured
+		absent bool
+		want   int
+		// wantDrift are the drift logs as context/type/key
+		wantDrift []string
+	}{
+		{
+			name: "no drift",
+			cached: map[string][]*unstructured.Unstructured{
+				"c1": {newObj("Namespace", "b", nil), newObj("Namespace", "a", nil)},
+				"c2": {newObj("Namespace", "a", nil), newObj("Namespace", "b", nil)},
+			},
+			want: util.ExitOK,
+		},
+		{
+			name: "missing and extra",
+			cached: map[string][]*unstructured.Unstructured{
+				"c1": {newObj("Namespace", "a", nil), newObj("Namespace", "b", nil)},
+				"c2": {newObj("Namespace", "b", nil), newObj("Namespace", "c", nil)},
+			},
+			want:      util.ExitDrift,
+			wantDrift: []string{"c2/extra/c", "c2/missing/a"},
+		},
+		{
+			name: "differing",
+			cached: map[string][]*unstructured.Unstructured{
+				"c1": {newObj("Namespace", "a", map[string]string{"x": "y"}), newObj("Namespace", "b", nil)},
+				"c2": {newObj("Namespace", "a", nil), newObj("Namespace", "b", nil)},
+			},
+			want:      util.ExitDrift,
+			wantDrift: []string{"c1/differing/a"},
+		},
+		{
+			name:      "not served",
+			cached:    map[string][]*unstructured.Unstructured{"c1": nil, "c2": nil},
+			absent:    true,
+			want:      util.ExitDrift,
+			wantDrift: []string{"c1/not-served/", "c2/not-served/"},
+		},
+		{
+			name: "not fetched everywhere",
+			cached: map[string][]*unstructured.Unstructured{
+				"c1": {newObj("Namespace", "a", nil)},
+			},
+			want: util.ExitPartialFailure,
+			// drift found where it could be compared is still logged
+			wantDrift: []string{"c1/missing/b"},
+		},
+		{
+			name: "not fetched anywhere",
+			want: util.ExitFailure,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := cache.NewMemStore()
+			for context, objs := range tt.cached {
+				if err := store.Put(context, "namespace.", objs, &cache.Meta{Absent: tt.absent}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			core, logs := observer.New(zapcore.InfoLevel)
+			if got := compare(zap.New(core).Sugar(), store, manifests, gvkConfigs, []string{"c1", "c2"}); got != tt.want {
+				t.Errorf("compare() = %d, want %d", got, tt.want)
+			}
+			var gotDrift []string
+			for _, e := range logs.FilterMessage("drift").All() {
+				fields := e.ContextMap()
+				key, _ := fields["key"].(string)
+				gotDrift = append(gotDrift, fields["context"].(string)+"/"+fields["type"].(string)+"/"+key)
+			}
+			sort.Strings(gotDrift)
+			if !reflect.DeepEqual(gotDrift, tt.wantDrift) {
+				t.Errorf("drift = %v, want %v", gotDrift, tt.wantDrift)
+			}
+		})
+	}
+}
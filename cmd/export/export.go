@@ -0,0 +1,117 @@
+package export
+
+import (
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/mlowery/mcfetcher/pkg/cache"
+	"github.com/mlowery/mcfetcher/pkg/config"
+	oerrors "github.com/mlowery/mcfetcher/pkg/errors"
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+// contextObjects are the cached objects of one (context, GVK).
+type contextObjects struct {
+	context string
+	// labels are the inventory labels of the context
+	labels    map[string]string
+	gvkString string
+	gvkConfig *config.GVK
+	objs      []*unstructured.Unstructured
+}
+
+var Cmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the sanitized cache to other formats.",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, dFunc := util.NewLogger()
+		defer dFunc()
+		defer func(start time.Time) {
+			logger.Infow("done", "totalDuration", time.Since(start))
+		}(time.Now())
+
+		gvkConfigs := config.ReadGVKOrDie()
+		clusters := config.ReadClustersOrDie()
+		contexts := config.ClusterNames(clusters)
+		gitDir := config.ReadString("git", "")
+		sqlitePath := config.ReadString("sqlite", "")
+		if len(gitDir) == 0 && len(sqlitePath) == 0 {
+			logger.Fatalf("one of git or sqlite is required")
+		}
+
+		workDir, err := util.EnsureWorkDir()
+		if err != nil {
+			logger.Fatalf("failed to ensure work dir: %v", err)
+		}
+		// a fetch writing the caches at the same time would make the export a mix of two runs
+		unlock, err := util.LockWorkDir(workDir)
+		if err != nil {
+			logger.Fatalf("failed to lock work dir: %v", err)
+		}
+		defer unlock()
+		store := cache.NewFileStore(workDir)
+
+		var errorCount int
+		var all []*contextObjects
+		for _, cluster := range clusters {
+			context := cluster.Name
+			for gvkString, gvkConfig := range gvkConfigs {
+				logger := logger.With("context", context, "gvk", gvkString)
+				objs, err := store.Get(context, gvkString)
+				if err != nil {
+					errorCount++
+					logger.Errorw(oerrors.New(err, "failed to read cached records",
+						"gvk", gvkString, "context", context).Error())
+					continue
+				}
+				if objs == nil {
+					logger.Warnw("no cached records (run fetch first)")
+					continue
+				}
+				all = append(all, &contextObjects{
+					context:   context,
+					labels:    cluster.Labels,
+					gvkString: gvkString,
+					gvkConfig: gvkConfig,
+					objs:      objs,
+				})
+			}
+		}
+		// a partial export would record the unreadable caches as deleted, so nothing is exported
+		if errorCount > 0 {
+			logger.Infof("failed with %d errors (written to stderr); not exporting", errorCount)
+			os.Exit(util.ExitFailure)
+		}
+
+		if len(gitDir) > 0 {
+			committed, err := exportGit(gitDir, contexts, all)
+			if err != nil {
+				logger.Fatalf("failed to export to git: %v", err)
+			}
+			if committed {
+				logger.Infow("committed snapshot", "dir", gitDir)
+			} else {
+				logger.Infow("no changes to commit", "dir", gitDir)
+			}
+		}
+		if len(sqlitePath) > 0 {
+			if err := exportSQLite(sqlitePath, all, config.ReadBool("sqlite-fields")); err != nil {
+				logger.Fatalf("failed to export to sqlite: %v", err)
+			}
+			logger.Infow("wrote database", "filename", sqlitePath)
+		}
+	},
+}
+
+func init() {
+	Cmd.Flags().String("git", "", "git repository directory to write objects to and commit")
+	viper.BindPFlag("git", Cmd.Flags().Lookup("git"))
+	Cmd.Flags().String("sqlite", "", "SQLite database file to (re)create")
+	viper.BindPFlag("sqlite", Cmd.Flags().Lookup("sqlite"))
+	Cmd.Flags().Bool("sqlite-fields", false, "also write flattened (path, value) rows to the fields table")
+	viper.BindPFlag("sqlite-fields", Cmd.Flags().Lookup("sqlite-fields"))
+}
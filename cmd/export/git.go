@@ -0,0 +1,134 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// clusterScopedDir is used in place of a namespace for cluster-scoped objects.
+const clusterScopedDir = "_cluster"
+
+// exportGit writes objects to <context>/<gvk>/<namespace>/<name>.yaml in dir and commits them. It returns false if
+// there was nothing to commit.
+func exportGit(dir string, contexts []string, all []*contextObjects) (bool, error) {
+	if err := ensureGitRepo(dir); err != nil {
+		return false, errors.Wrapf(err, "failed to ensure git repo")
+	}
+	// context -> gvk -> count
+	counts := map[string]map[string]int{}
+	for _, context := range contexts {
+		counts[context] = map[string]int{}
+	}
+	for _, co := range all {
+		if err := writeObjects(filepath.Join(dir, co.context, co.gvkString), co.objs); err != nil {
+			return false, errors.Wrapf(err, "failed to write objects (context=%s) (gvk=%s)", co.context, co.gvkString)
+		}
+		counts[co.context][co.gvkString] = len(co.objs)
+	}
+	return commit(dir, commitMessage(counts))
+}
+
+// writeObjects replaces the contents of dir with one YAML file per object laid out as <namespace>/<name>.yaml.
+func writeObjects(dir string, objs []*unstructured.Unstructured) error {
+	// start from scratch so that deleted objects show up as deleted files
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.Wrapf(err, "failed to remove %q", dir)
+	}
+	for _, obj := range objs {
+		namespace := obj.GetNamespace()
+		if len(namespace) == 0 {
+			namespace = clusterScopedDir
+		}
+		nsDir := filepath.Join(dir, namespace)
+		if err := os.MkdirAll(nsDir, 0755); err != nil {
+			return errors.Wrapf(err, "failed to create directory %q", nsDir)
+		}
+		// yaml.Marshal goes through a map so keys are sorted and output is stable across runs
+		b, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return errors.Wrapf(err, "failed to marshal %s/%s", namespace, obj.GetName())
+		}
+		filename := filepath.Join(nsDir, obj.GetName()+".yaml")
+		if err := ioutil.WriteFile(filename, b, 0644); err != nil {
+			return errors.Wrapf(err, "failed to write %q", filename)
+		}
+	}
+	return nil
+}
+
+func commitMessage(counts map[string]map[string]int) string {
+	var contexts []string
+	var total int
+	for context, gvkCounts := range counts {
+		contexts = append(contexts, context)
+		for _, count := range gvkCounts {
+			total += count
+		}
+	}
+	sort.Strings(contexts)
+	var b strings.Builder
+	fmt.Fprintf(&b, "mcfetcher export: %d objects from %d contexts\n\n", total, len(contexts))
+	for _, context := range contexts {
+		var gvks []string
+		var contextTotal int
+		for gvkString, count := range counts[context] {
+			gvks = append(gvks, fmt.Sprintf("%s=%d", gvkString, count))
+			contextTotal += count
+		}
+		sort.Strings(gvks)
+		fmt.Fprintf(&b, "%s: %d objects (%s)\n", context, contextTotal, strings.Join(gvks, ", "))
+	}
+	return b.String()
+}
+
+func ensureGitRepo(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create directory %q", dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to check for .git")
+	}
+	_, err := git(dir, "init")
+	return err
+}
+
+// commit stages everything in dir and commits it. It returns false if there was nothing to commit.
+func commit(dir, message string) (bool, error) {
+	if _, err := git(dir, "add", "--all", "."); err != nil {
+		return false, err
+	}
+	out, err := git(dir, "status", "--porcelain")
+	if err != nil {
+		return false, err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return false, nil
+	}
+	if _, err := git(dir, "commit", "--quiet", "--message", message); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "git %s failed: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
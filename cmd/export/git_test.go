@@ -0,0 +1,155 @@
+package export
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// listFiles returns the files under dir outside .git relative to dir.
+func listFiles(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func commitCount(t *testing.T, dir string) string {
+	out, err := git(dir, "rev-list", "--count", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestExportGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	for _, env := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		defer os.Setenv(env, os.Getenv(env))
+		os.Setenv(env, "test")
+	}
+	for _, env := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		defer os.Setenv(env, os.Getenv(env))
+		os.Setenv(env, "test@example.com")
+	}
+	dir, err := ioutil.TempDir("", "mcfetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the repo is created by the first export
+	dir = filepath.Join(dir, "repo")
+
+	contexts := []string{"c1", "c2"}
+	all := []*contextObjects{
+		newContextObjects("c1", newConfigMap("ns", "a", map[string]interface{}{"k": "v"}),
+			newConfigMap("", "b", nil)),
+		newContextObjects("c2", newConfigMap("ns", "a", map[string]interface{}{"k": "v2"})),
+	}
+	committed, err := exportGit(dir, contexts, all)
+	if err != nil || !committed {
+		t.Fatalf("exportGit() = %v, %v, want true, nil", committed, err)
+	}
+	want := []string{
+		"c1/configmap./_cluster/b.yaml",
+		"c1/configmap./ns/a.yaml",
+		"c2/configmap./ns/a.yaml",
+	}
+	if got := listFiles(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "c2/configmap./ns/a.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantYAML := "apiVersion: v1\ndata:\n  k: v2\nkind: ConfigMap\nmetadata:\n  name: a\n  namespace: ns\n"
+	if string(b) != wantYAML {
+		t.Errorf("c2/configmap./ns/a.yaml = %q, want %q", b, wantYAML)
+	}
+	if got := commitCount(t, dir); got != "1" {
+		t.Errorf("commits = %s, want 1", got)
+	}
+
+	// the same objects again are not committed
+	committed, err = exportGit(dir, contexts, all)
+	if err != nil || committed {
+		t.Fatalf("exportGit() without changes = %v, %v, want false, nil", committed, err)
+	}
+	if got := commitCount(t, dir); got != "1" {
+		t.Errorf("commits = %s, want 1", got)
+	}
+
+	// deleted objects are deleted files
+	all[0] = newContextObjects("c1", newConfigMap("ns", "a", map[string]interface{}{"k": "v"}))
+	committed, err = exportGit(dir, contexts, all)
+	if err != nil || !committed {
+		t.Fatalf("exportGit() after delete = %v, %v, want true, nil", committed, err)
+	}
+	if got := listFiles(t, dir); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("files = %v, want %v", got, want[1:])
+	}
+	if got := commitCount(t, dir); got != "2" {
+		t.Errorf("commits = %s, want 2", got)
+	}
+	out, err := git(dir, "log", "-1", "--format=%B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(string(out)), commitMessage(map[string]map[string]int{
+		"c1": {"configmap.": 1}, "c2": {"configmap.": 1}}); got != strings.TrimSpace(want) {
+		t.Errorf("commit message = %q, want %q", got, want)
+	}
+}
+
+func Test_commitMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		counts map[string]map[string]int
+		want   string
+	}{
+		{
+			name:   "empty",
+			counts: map[string]map[string]int{},
+			want:   "mcfetcher export: 0 objects from 0 contexts\n\n",
+		},
+		{
+			name: "sorted",
+			counts: map[string]map[string]int{
+				"c2": {"deployment.apps": 2, "configmap.": 3},
+				"c1": {},
+			},
+			want: "mcfetcher export: 5 objects from 2 contexts\n\n" +
+				"c1: 0 objects ()\n" +
+				"c2: 5 objects (configmap.=3, deployment.apps=2)\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := commitMessage(tt.counts); got != tt.want {
+				t.Errorf("commitMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
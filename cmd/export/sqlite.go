@@ -0,0 +1,171 @@
+package export
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+const schema = `
+CREATE TABLE contexts (
+	id     INTEGER PRIMARY KEY,
+	name   TEXT NOT NULL UNIQUE,
+	labels TEXT NOT NULL
+);
+CREATE TABLE gvks (
+	id         INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL UNIQUE,
+	group_name TEXT NOT NULL,
+	version    TEXT NOT NULL,
+	kind       TEXT NOT NULL
+);
+CREATE TABLE objects (
+	id         INTEGER PRIMARY KEY,
+	context_id INTEGER NOT NULL REFERENCES contexts(id),
+	gvk_id     INTEGER NOT NULL REFERENCES gvks(id),
+	namespace  TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	body       TEXT NOT NULL,
+	UNIQUE (context_id, gvk_id, namespace, name)
+);
+CREATE TABLE fields (
+	object_id INTEGER NOT NULL REFERENCES objects(id),
+	path      TEXT NOT NULL,
+	value     TEXT
+);
+CREATE INDEX fields_path ON fields (path);
+`
+
+// exportSQLite recreates the database at path from scratch. body and labels columns hold JSON so that SQLite's JSON
+// functions can be used on them. If withFields is true, every leaf value is also written to the fields table. The new
+// database is built next to path and renamed over it so that a failed export leaves the last one in place.
+func exportSQLite(path string, all []*contextObjects, withFields bool) error {
+	file, err := util.CreateTemp(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create temporary database")
+	}
+	if err := writeSQLite(file.Name(), all, withFields); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	return util.CommitTemp(file, path, 0644)
+}
+
+// writeSQLite writes all to the empty database at path.
+func writeSQLite(path string, all []*contextObjects, withFields bool) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open database")
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrapf(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(schema); err != nil {
+		return errors.Wrapf(err, "failed to create schema")
+	}
+
+	contextIDs := map[string]int64{}
+	gvkIDs := map[string]int64{}
+	for _, co := range all {
+		contextID, ok := contextIDs[co.context]
+		if !ok {
+			labels := co.labels
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			labelsJSON, err := json.Marshal(labels)
+			if err != nil {
+				return errors.Wrapf(err, "failed to marshal labels of %s", co.context)
+			}
+			res, err := tx.Exec(`INSERT INTO contexts (name, labels) VALUES (?, ?)`, co.context, string(labelsJSON))
+			if err != nil {
+				return errors.Wrapf(err, "failed to insert context")
+			}
+			if contextID, err = res.LastInsertId(); err != nil {
+				return errors.Wrapf(err, "failed to get context id")
+			}
+			contextIDs[co.context] = contextID
+		}
+		gvkID, ok := gvkIDs[co.gvkString]
+		if !ok {
+			gvk := co.gvkConfig.GroupVersionKind
+			res, err := tx.Exec(`INSERT INTO gvks (name, group_name, version, kind) VALUES (?, ?, ?, ?)`,
+				co.gvkString, gvk.Group, gvk.Version, gvk.Kind)
+			if err != nil {
+				return errors.Wrapf(err, "failed to insert gvk")
+			}
+			if gvkID, err = res.LastInsertId(); err != nil {
+				return errors.Wrapf(err, "failed to get gvk id")
+			}
+			gvkIDs[co.gvkString] = gvkID
+		}
+		for _, obj := range co.objs {
+			body, err := json.Marshal(obj.Object)
+			if err != nil {
+				return errors.Wrapf(err, "failed to marshal %s", obj.GetName())
+			}
+			res, err := tx.Exec(`INSERT INTO objects (context_id, gvk_id, namespace, name, body) VALUES (?, ?, ?, ?, ?)`,
+				contextID, gvkID, obj.GetNamespace(), obj.GetName(), string(body))
+			if err != nil {
+				return errors.Wrapf(err, "failed to insert object %s", obj.GetName())
+			}
+			if !withFields {
+				continue
+			}
+			objectID, err := res.LastInsertId()
+			if err != nil {
+				return errors.Wrapf(err, "failed to get object id")
+			}
+			err = flatten("", obj.Object, func(path string, value string) error {
+				_, err := tx.Exec(`INSERT INTO fields (object_id, path, value) VALUES (?, ?, ?)`, objectID, path, value)
+				return err
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to insert fields of %s", obj.GetName())
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrapf(err, "failed to commit transaction")
+	}
+	return nil
+}
+
+// flatten calls f for every leaf of v with its path in the same /-separated form as keep-paths. List items are
+// addressed by index. Strings are passed as is; other values are JSON encoded.
+func flatten(path string, v interface{}, f func(path, value string) error) error {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if err := flatten(fmt.Sprintf("%s/%s", path, k), child, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		for i, child := range t {
+			if err := flatten(fmt.Sprintf("%s/%d", path, i), child, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	case string:
+		return f(path, t)
+	default:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		return f(path, string(b))
+	}
+}
@@ -0,0 +1,134 @@
+package export
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8sschema "k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/mlowery/mcfetcher/pkg/config"
+)
+
+func newConfigMap(namespace, name string, data map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"data": data}}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func newContextObjects(context string, objs ...*unstructured.Unstructured) *contextObjects {
+	return &contextObjects{
+		context:   context,
+		labels:    map[string]string{"env": context},
+		gvkString: "configmap.",
+		gvkConfig: &config.GVK{GroupVersionKind: k8sschema.GroupVersionKind{Kind: "configmap"}},
+		objs:      objs,
+	}
+}
+
+func queryStrings(t *testing.T, db *sql.DB, query string) []string {
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("query %q error = %v", query, err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, s)
+	}
+	return got
+}
+
+func TestExportSQLite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mcfetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.db")
+
+	all := []*contextObjects{
+		newContextObjects("c1", newConfigMap("ns", "a", map[string]interface{}{"k": "v1"})),
+		newContextObjects("c2", newConfigMap("ns", "a", map[string]interface{}{"k": "v2"}),
+			newConfigMap("ns", "b", map[string]interface{}{"k": "v"})),
+	}
+	if err := exportSQLite(path, all, true); err != nil {
+		t.Fatalf("exportSQLite() error = %v", err)
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{`SELECT name || ' ' || labels FROM contexts ORDER BY name`, []string{`c1 {"env":"c1"}`, `c2 {"env":"c2"}`}},
+		{`SELECT name || ' ' || kind FROM gvks`, []string{"configmap. configmap"}},
+		{`SELECT c.name || ' ' || o.namespace || '/' || o.name FROM objects o JOIN contexts c ON c.id = o.context_id
+			ORDER BY c.name, o.name`, []string{"c1 ns/a", "c2 ns/a", "c2 ns/b"}},
+		{`SELECT c.name || ' ' || f.value FROM fields f JOIN objects o ON o.id = f.object_id
+			JOIN contexts c ON c.id = o.context_id WHERE f.path = '/data/k' AND o.name = 'a' ORDER BY c.name`,
+			[]string{"c1 v1", "c2 v2"}},
+		{`SELECT body FROM objects WHERE name = 'b'`, []string{
+			`{"apiVersion":"v1","data":{"k":"v"},"kind":"ConfigMap","metadata":{"name":"b","namespace":"ns"}}`}},
+	}
+	for _, tt := range tests {
+		if got := queryStrings(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+	db.Close()
+
+	// a failed export leaves the last database in place
+	duplicate := newContextObjects("c1", newConfigMap("ns", "a", nil), newConfigMap("ns", "a", nil))
+	if err := exportSQLite(path, []*contextObjects{duplicate}, false); err == nil {
+		t.Fatalf("exportSQLite() with duplicate objects error = nil")
+	}
+	db, err = sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := queryStrings(t, db, `SELECT name FROM contexts ORDER BY name`); !reflect.DeepEqual(got,
+		[]string{"c1", "c2"}) {
+		t.Errorf("contexts after failed export = %v, want the last export", got)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 1 {
+		t.Errorf("files after failed export = %v, want only %s", files, path)
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	v := map[string]interface{}{
+		"a": map[string]interface{}{"b": "s", "c": int64(1)},
+		"l": []interface{}{true, map[string]interface{}{"d": nil}},
+	}
+	var got []string
+	err := flatten("", v, func(path, value string) error {
+		got = append(got, path+"="+value)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("flatten() error = %v", err)
+	}
+	sort.Strings(got)
+	if want := []string{"/a/b=s", "/a/c=1", "/l/0=true", "/l/1/d=null"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("flatten() = %v, want %v", got, want)
+	}
+}
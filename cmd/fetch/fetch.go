@@ -2,33 +2,28 @@ package fetch
 
 import (
 	ctx "context"
+	"encoding/json"
 	"fmt"
 	"os"
-	"sync"
+	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"go.uber.org/zap"
-	"k8s.io/apimachinery/pkg/api/meta"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/tools/pager"
-
-	dynamic2 "github.com/mlowery/mcfetcher/pkg/client/dynamic"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/mlowery/mcfetcher/pkg/cache"
 	"github.com/mlowery/mcfetcher/pkg/config"
 	oerrors "github.com/mlowery/mcfetcher/pkg/errors"
+	"github.com/mlowery/mcfetcher/pkg/fetcher"
+	"github.com/mlowery/mcfetcher/pkg/metrics"
+	"github.com/mlowery/mcfetcher/pkg/ratelimit"
+	"github.com/mlowery/mcfetcher/pkg/source"
 	"github.com/mlowery/mcfetcher/pkg/util"
 )
 
-var (
-	workDir    string
-	gvkConfigs map[string]*config.GVK
-)
-
 var Cmd = &cobra.Command{
 	Use:   "fetch",
 	Short: "Fetch, filter, and sanitize objects across Kubernetes clusters.",
@@ -39,174 +34,231 @@ var Cmd = &cobra.Command{
 			logger.Infow("done", "totalDuration", time.Since(start))
 		}(time.Now())
 
-		gvkConfigs = config.ReadGVKOrDie()
+		gvkConfigs := config.ReadGVKOrDie()
 
+		var workDir string
 		var err error
-		workDir, err = util.EnsureWorkDir()
+		if config.ReadBool("snapshot") {
+			snapshot := util.NewSnapshotName(time.Now())
+			workDir, err = util.EnsureWorkDir()
+			if err == nil {
+				workDir, err = util.CreateSnapshotDir(workDir, snapshot)
+			}
+			logger.Infow("writing snapshot", "snapshot", snapshot)
+		} else {
+			workDir, err = util.EnsureWorkDir()
+		}
 		if err != nil {
 			logger.Fatalf("failed to ensure work dir: %v", err)
 		}
+		unlock, err := util.LockWorkDir(workDir)
+		if err != nil {
+			logger.Fatalf("failed to lock work dir: %v", err)
+		}
+		defer unlock()
 
-		contexts := config.ReadStringSliceOrDie("kubeconfig-contexts")
+		clusters := config.ReadClustersOrDie()
+		contexts := config.ClusterNames(clusters)
+		contextLabels := map[string]map[string]string{}
+		for _, c := range clusters {
+			contextLabels[c.Name] = c.Labels
+		}
 
-		var wg sync.WaitGroup
-		contextCh := make(chan string)
-		errCh := make(chan error, len(contexts))
-		var errorCount int
+		compression, err := util.ParseCompression(config.ReadString("cache-compression", ""))
+		if err != nil {
+			logger.Errorf("failed to parse cache compression: %v", err)
+			os.Exit(util.ExitConfigError)
+		}
+		allowedFailedContexts, err := fetcher.ParseAllowedFailures(config.ReadString("allow-failed-contexts", ""),
+			len(contexts))
+		if err != nil {
+			logger.Errorf("failed to parse allow-failed-contexts: %v", err)
+			os.Exit(util.ExitConfigError)
+		}
+		maxErrors := config.ReadInt("max-errors")
+		if config.ReadBool("fail-fast") {
+			maxErrors = 1
+		}
 
-		go func() {
-			for err := range errCh {
-				errorCount++
-				logger.Errorw(err.Error())
+		// on a terminal, a progress view replaces the logs of the run itself unless they go to a file; warnings and
+		// above are still written above the view
+		var view *progressView
+		runLogger := logger
+		if len(config.ReadString("log-format", "")) == 0 && isTerminal(os.Stdout) {
+			view = newProgressView(os.Stdout, os.Stderr, contexts, len(gvkConfigs))
+			if len(config.ReadString("log-file", "")) == 0 {
+				runLogger = util.NewLoggerTo(view, zapcore.WarnLevel)
 			}
-		}()
-
-		for w := 1; w <= 10; w++ {
-			wg.Add(1)
-			go worker(logger.With("worker", w), contextCh, errCh, &wg)
 		}
 
-		for i, context := range contexts {
-			logger.Infow("queuing context", "context", context,
-				"progress", fmt.Sprintf("%d/%d", i+1, len(contexts)))
-			contextCh <- context
+		sources, err := source.NewFactory(config.ReadString("source", ""), source.LiveOptions{
+			Kubeconfig: config.ReadString("kubeconfig", util.InHomeDirOrDie(".kube/config")),
+			Clusters:   config.ClustersByName(clusters),
+			GlobalLimiter: ratelimit.New(viper.GetFloat64("global-rate-limit-qps"),
+				config.ReadInt("global-rate-limit-burst")),
+			Logger: runLogger,
+		})
+		if err != nil {
+			logger.Errorf("failed to parse source: %v", err)
+			os.Exit(util.ExitConfigError)
 		}
-		close(contextCh)
-
-		logger.Infow("all contexts queued; waiting for workers to finish")
-		wg.Wait()
 
-		close(errCh)
-
-		if errorCount > 0 {
-			logger.Infof("failed with %d errors (written to stderr)", errorCount)
-			os.Exit(1)
+		var started int32
+		onProgress := func(p *fetcher.Progress) {
+			switch p.Type {
+			case fetcher.ContextStarted:
+				logger.Infow("started context", "context", p.Context, "labels", contextLabels[p.Context],
+					"progress", fmt.Sprintf("%d/%d", atomic.AddInt32(&started, 1), len(contexts)))
+			case fetcher.GVKDone:
+				for _, err := range p.Result.Errors() {
+					logger.Errorw(err.Error(), "class", oerrors.Classify(err))
+				}
+			}
+		}
+		if view != nil {
+			onProgress = view.OnProgress
+		}
+		f, err := fetcher.New(fetcher.Options{
+			Contexts:      contexts,
+			ContextLabels: contextLabels,
+			GVKConfigs:    gvkConfigs,
+			Store:         cache.NewCompressedFileStore(workDir, compression),
+			Sources:       sources,
+			Concurrency:   config.ReadInt("concurrency"),
+			MaxErrors:     maxErrors,
+			Logger:        runLogger,
+			OnProgress:    onProgress,
+		})
+		if err != nil {
+			logger.Fatalf("failed to create fetcher: %v", err)
+		}
+		if view != nil {
+			view.Start()
+		}
+		results := f.Run(ctx.Background())
+		if view != nil {
+			view.Stop()
 		}
-	},
-}
 
-func worker(l *zap.SugaredLogger, contextCh <-chan string, errCh chan<- error, wg *sync.WaitGroup) {
-	for context := range contextCh {
-		logger := l.With("context", context)
-		logger.Infow("processing context")
-
-		for gvkString, gvkConfig := range gvkConfigs {
-			logger := logger.With("gvk", gvkString)
-			// if there is a file in the work-dir, don't call Kube since that is the most expensive part
-			filename, err := util.MkCacheFilename(workDir, context, gvkString, "json")
-			if err != nil {
-				errCh <- oerrors.New(err, "failed to ensure cache dir",
-					"gvk", gvkString, "context", context)
+		// one line per (context, GVK) and then totals
+		sort.Slice(results, func(i, j int) bool {
+			if results[i].Context != results[j].Context {
+				return results[i].Context < results[j].Context
+			}
+			return results[i].GVK < results[j].GVK
+		})
+		var errorCount, succeededCount, listedCount, sanitizedCount int
+		var rateLimitWait time.Duration
+		errorsByClass := map[oerrors.Class]int{}
+		// clusters on different Kubernetes releases can serve a version-less GVK in different versions
+		servedVersions := map[string]map[string]string{}
+		for _, r := range results {
+			if len(r.ServedVersion) > 0 {
+				if servedVersions[r.GVK] == nil {
+					servedVersions[r.GVK] = map[string]string{}
+				}
+				servedVersions[r.GVK][r.Context] = r.ServedVersion
+			}
+			errorCount += len(r.Errors())
+			for _, err := range r.Errors() {
+				errorsByClass[oerrors.Classify(err)]++
+			}
+			if len(r.Errors()) == 0 {
+				succeededCount++
+			}
+			listedCount += r.ListedCount
+			sanitizedCount += r.SanitizedCount
+			rateLimitWait += r.RateLimitWait
+			if runLogger != logger {
+				// already shown
 				continue
 			}
+			logger.Infow("summary", "context", r.Context, "gvk", r.GVK, "fromCache", r.FromCache, "absent", r.Absent,
+				"servedVersion", r.ServedVersion,
+				"origObjCount", r.ListedCount, "sanitizedObjCount", r.SanitizedCount, "duration", r.Duration,
+				"rateLimitWait", r.RateLimitWait, "errors", len(r.Errors()))
+		}
+		for gvkString, versions := range servedVersions {
+			distinct := map[string]bool{}
+			for _, v := range versions {
+				distinct[v] = true
+			}
+			if len(distinct) > 1 {
+				logger.Warnw("served versions differ across contexts", "gvk", gvkString, "servedVersions", versions)
+			}
+		}
+		logger.Infow("summary", "contexts", len(contexts), "gvks", len(gvkConfigs), "origObjCount", listedCount,
+			"sanitizedObjCount", sanitizedCount, "rateLimitWait", rateLimitWait, "errors", errorCount,
+			"errorsByClass", errorsByClass)
 
-			sanObjects, err := util.ReadRawObjects(filename)
-			if err != nil {
-				errCh <- oerrors.New(err, "failed to read cached records",
-					"gvk", gvkString, "context", context, "filename", filename)
-				continue
+		if errorReport := config.ReadString("error-report", ""); len(errorReport) > 0 {
+			if err := writeErrorReport(errorReport, results); err != nil {
+				logger.Errorw(err.Error())
 			}
-			if sanObjects == nil {
-				restConfig, err := getClientConfig(context, config.ReadString("kubeconfig", util.InHomeDirOrDie(".kube/config"))).ClientConfig()
-				if err != nil {
-					errCh <- oerrors.New(err, "failed to get rest config",
-						"gvk", gvkString, "context", context)
-					continue
-				}
-				client, err := dynamic2.New(restConfig)
-				if err != nil {
-					errCh <- oerrors.New(err, "failed to create client (is proxy configured correctly?)",
-						"gvk", gvkString, "context", context)
-					continue
-				}
+		}
 
-				logger.Infow("calling Kube to fetch all")
-				// use pager to avoid: Stream error http2.StreamError{StreamID:0x5, Code:0x2, Cause:error(nil)} when
-				// reading response body, may be caused by closed connection. Please retry.
-				objPager := pager.New(pager.SimplePageFunc(func(opts metav1.ListOptions) (runtime.Object, error) {
-					r, err := client.GetResourceInterface(gvkConfig.GroupVersionKind, metav1.NamespaceAll)
-					if err != nil {
-						return nil, errors.Wrapf(err, "failed to get resource interface")
-					}
-					return r.List(opts)
-				}))
-				start := time.Now()
-				rawList, _, err := objPager.List(ctx.TODO(), metav1.ListOptions{})
-				rtt := time.Since(start)
-				if err != nil {
-					errCh <- oerrors.New(err, "failed to list",
-						"gvk", gvkString, "context", context)
-					continue
-				}
-				logger.Infow("called Kube", "duration", rtt)
-				origObjects, sanObjects, err := extractList(logger, errCh, rawList, gvkConfig)
-				if err != nil {
-					errCh <- oerrors.New(err, "failed to extract list",
-						"gvk", gvkString, "context", context)
-					continue
-				}
-				logger.Infow("caching", "filename", filename, "origObjCount", len(origObjects), "sanitizedObjCount", len(sanObjects))
-				err = util.WriteRawObjects(filename, origObjects)
-				if err != nil {
-					errCh <- oerrors.New(err, "failed to write original records",
-						"gvk", gvkString, "context", context)
-					continue
-				}
-				err = util.WriteRawObjects(filename, sanObjects)
-				if err != nil {
-					errCh <- oerrors.New(err, "failed to write sanitized records",
-						"gvk", gvkString, "context", context)
-					continue
-				}
-			} else {
-				logger.Infow("using cached results (to skip cache, delete file)",
-					"filename", filename, "sanitizedObjCount", len(sanObjects))
+		if metricsFile := config.ReadString("metrics-file", ""); len(metricsFile) > 0 {
+			if err := metrics.WriteTextfile(metricsFile); err != nil {
+				logger.Errorw(err.Error())
 			}
 		}
-	}
-	wg.Done()
-}
 
-func extractList(logger *zap.SugaredLogger, errCh chan<- error, object runtime.Object,
-	gvkConfig *config.GVK) ([]*unstructured.Unstructured, []*unstructured.Unstructured, error) {
-	items, err := meta.ExtractList(object)
-	if err != nil {
-		return nil, nil, errors.Wrapf(err, "failed to extract list")
-	}
-	var orig, l []*unstructured.Unstructured
-	for _, item := range items {
-		uObj := item.(*unstructured.Unstructured)
-		orig = append(orig, uObj)
-		sanObj, err := util.Sanitize(logger, uObj, gvkConfig.IgnoreNames, gvkConfig.PathValueFilters,
-			gvkConfig.KeepAnnotations, gvkConfig.KeepLabels, gvkConfig.KeepPaths, gvkConfig.IgnorePaths,
-			gvkConfig.KeepDeleted)
-		if err != nil {
-			errCh <- oerrors.New(err, "failed to sanitize",
-				"gvk", uObj.GetObjectKind().GroupVersionKind().String(), "name", uObj.GetName())
-			continue
+		failedCode := util.ExitPartialFailure
+		if succeededCount == 0 {
+			failedCode = util.ExitFailure
 		}
-		if sanObj != nil {
-			l = append(l, sanObj)
+		failedContexts := fetcher.FailedContexts(results)
+		if skipped := len(contexts)*len(gvkConfigs) - len(results); skipped > 0 {
+			logger.Infof("stopped early with %d errors (written to stderr); skipped %d context/GVK pairs",
+				errorCount, skipped)
+			os.Exit(failedCode)
 		}
-	}
-	return orig, l, nil
+		if errorCount == 0 {
+			return
+		}
+		if len(failedContexts) <= allowedFailedContexts {
+			logger.Infow("ignoring failed contexts", "contexts", failedContexts, "allowed", allowedFailedContexts,
+				"errorCount", errorCount)
+			return
+		}
+		logger.Infof("failed with %d errors in %d contexts (written to stderr)", errorCount, len(failedContexts))
+		os.Exit(failedCode)
+	},
 }
 
-func getClientConfig(context, kubeconfig string) clientcmd.ClientConfig {
-	pathOptions := clientcmd.NewDefaultPathOptions()
-	loadingRules := *pathOptions.LoadingRules
-	loadingRules.Precedence = pathOptions.GetLoadingPrecedence()
-	loadingRules.ExplicitPath = kubeconfig
-	overrides := &clientcmd.ConfigOverrides{
-		CurrentContext: context,
+// writeErrorReport writes every error in results to path as a JSON array. Errors from pkg/errors carry their class
+// and fields (context, gvk, and so on) so the report can be grouped with e.g. jq.
+func writeErrorReport(path string, results []*fetcher.Result) error {
+	errs := []error{}
+	for _, r := range results {
+		errs = append(errs, r.Errors()...)
 	}
-	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(&loadingRules, overrides)
+	b, err := json.MarshalIndent(errs, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal error report")
+	}
+	if err := util.WriteFileAtomic(path, append(b, '\n'), 0644); err != nil {
+		return errors.Wrapf(err, "failed to write error report")
+	}
+	return nil
 }
 
 func init() {
-	Cmd.PersistentFlags().String("kubeconfig", "", "kubeconfig")
-	viper.BindPFlag("kubeconfig", Cmd.PersistentFlags().Lookup("kubeconfig"))
-
-	Cmd.PersistentFlags().StringSlice("kubeconfig-contexts", []string{}, "kubeconfig-contexts")
-	viper.BindPFlag("kubeconfig-contexts", Cmd.PersistentFlags().Lookup("kubeconfig-contexts"))
+	Cmd.Flags().Bool("snapshot", false, "write results to a new timestamped snapshot under <work-dir>/snapshots")
+	viper.BindPFlag("snapshot", Cmd.Flags().Lookup("snapshot"))
+	Cmd.Flags().Int("concurrency", 10, "number of contexts to fetch at once")
+	viper.BindPFlag("concurrency", Cmd.Flags().Lookup("concurrency"))
+	Cmd.Flags().String("source", "live", "where to list objects from: live, dir:<path>, or archive:<path.tar.gz>")
+	viper.BindPFlag("source", Cmd.Flags().Lookup("source"))
+	Cmd.Flags().String("metrics-file", "", "write metrics to this file in textfile collector format when done")
+	viper.BindPFlag("metrics-file", Cmd.Flags().Lookup("metrics-file"))
+	Cmd.Flags().Bool("fail-fast", false, "stop at the first error (same as --max-errors=1)")
+	viper.BindPFlag("fail-fast", Cmd.Flags().Lookup("fail-fast"))
+	Cmd.Flags().Int("max-errors", 0, "stop once this many errors have occurred (0 for no limit)")
+	viper.BindPFlag("max-errors", Cmd.Flags().Lookup("max-errors"))
+	Cmd.Flags().String("allow-failed-contexts", "",
+		"exit 0 if at most this many contexts failed, as a count (e.g. 2) or a percentage of contexts (e.g. 10%)")
+	viper.BindPFlag("allow-failed-contexts", Cmd.Flags().Lookup("allow-failed-contexts"))
+	Cmd.Flags().String("error-report", "", "write every error with its class, context, and GVK to this file as JSON")
+	viper.BindPFlag("error-report", Cmd.Flags().Lookup("error-report"))
 }
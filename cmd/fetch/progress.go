@@ -0,0 +1,207 @@
+package fetch
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/mlowery/mcfetcher/pkg/fetcher"
+)
+
+const (
+	redrawInterval = 250 * time.Millisecond
+	// used if the terminal size can't be read
+	defaultWidth = 120
+)
+
+// isTerminal returns true if f is a terminal.
+func isTerminal(f *os.File) bool {
+	return terminal.IsTerminal(int(f.Fd()))
+}
+
+// progressView draws the state of each running context in place on a terminal. Errors and logs written to it are
+// written to errOut above it as they happen so that they stay on screen.
+type progressView struct {
+	out      io.Writer
+	errOut   io.Writer
+	start    time.Time
+	gvkCount int
+	order    []string
+
+	mu       sync.Mutex
+	contexts map[string]*contextProgress
+	// lines is the number of lines drawn last, which are cleared before drawing again
+	lines  int
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+type contextProgress struct {
+	started  bool
+	done     bool
+	gvksDone int
+	errors   int
+	// gvk is being listed; pages and listed are its progress
+	gvk    string
+	pages  int
+	listed int
+}
+
+func newProgressView(out io.Writer, errOut io.Writer, contexts []string, gvkCount int) *progressView {
+	v := &progressView{
+		out:      out,
+		errOut:   errOut,
+		start:    time.Now(),
+		gvkCount: gvkCount,
+		order:    contexts,
+		contexts: map[string]*contextProgress{},
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+	for _, context := range contexts {
+		v.contexts[context] = &contextProgress{}
+	}
+	return v
+}
+
+// Start redraws the view periodically until Stop is called.
+func (v *progressView) Start() {
+	go func() {
+		defer close(v.doneCh)
+		ticker := time.NewTicker(redrawInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				v.mu.Lock()
+				v.draw()
+				v.mu.Unlock()
+			case <-v.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop draws the view one last time and leaves it on screen.
+func (v *progressView) Stop() {
+	close(v.stopCh)
+	<-v.doneCh
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.draw()
+}
+
+// OnProgress is a fetcher.Options.OnProgress.
+func (v *progressView) OnProgress(p *fetcher.Progress) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	cp, ok := v.contexts[p.Context]
+	if !ok {
+		return
+	}
+	switch p.Type {
+	case fetcher.ContextStarted:
+		cp.started = true
+	case fetcher.GVKStarted:
+		cp.gvk, cp.pages, cp.listed = p.GVK, 0, 0
+	case fetcher.GVKPage:
+		cp.pages, cp.listed = p.Pages, p.Listed
+	case fetcher.GVKDone:
+		cp.gvk = ""
+		cp.gvksDone++
+		errs := p.Result.Errors()
+		cp.errors += len(errs)
+		if len(errs) > 0 {
+			v.clear()
+			for _, err := range errs {
+				fmt.Fprintf(v.errOut, "error: %v\n", err)
+			}
+			v.draw()
+		}
+	case fetcher.ContextDone:
+		cp.done = true
+	}
+}
+
+// Write writes p to errOut above the view so that a logger can write to it without breaking the drawing.
+func (v *progressView) Write(p []byte) (int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.clear()
+	n, err := v.errOut.Write(p)
+	v.draw()
+	return n, err
+}
+
+// clear moves the cursor back over the last drawing and clears it. The caller must hold mu.
+func (v *progressView) clear() {
+	if v.lines > 0 {
+		fmt.Fprintf(v.out, "\x1b[%dA\x1b[J", v.lines)
+		v.lines = 0
+	}
+}
+
+// draw replaces the last drawing with the current state. The caller must hold mu.
+func (v *progressView) draw() {
+	width := defaultWidth
+	if f, ok := v.out.(*os.File); ok {
+		if w, _, err := terminal.GetSize(int(f.Fd())); err == nil && w > 0 {
+			width = w
+		}
+	}
+	var done, running, failed, errorCount int
+	var lines []string
+	for _, context := range v.order {
+		cp := v.contexts[context]
+		errorCount += cp.errors
+		if cp.errors > 0 {
+			failed++
+		}
+		switch {
+		case cp.done:
+			done++
+		case cp.started:
+			running++
+			lines = append(lines, cp.line(context, v.gvkCount))
+		}
+	}
+	header := fmt.Sprintf("[%s] contexts: %d/%d done, %d running, %d failed; errors: %d",
+		time.Since(v.start).Round(time.Second), done, len(v.order), running, failed, errorCount)
+	lines = append([]string{header}, lines...)
+
+	v.clear()
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(truncate(line, width))
+		b.WriteString("\n")
+	}
+	io.WriteString(v.out, b.String())
+	v.lines = len(lines)
+}
+
+func (cp *contextProgress) line(context string, gvkCount int) string {
+	line := fmt.Sprintf("  %s  %d/%d GVKs", context, cp.gvksDone, gvkCount)
+	if len(cp.gvk) > 0 {
+		line += fmt.Sprintf("  listing %s: page %d, %d objects", cp.gvk, cp.pages, cp.listed)
+	}
+	if cp.errors > 0 {
+		line += fmt.Sprintf("  %d errors", cp.errors)
+	}
+	return line
+}
+
+// truncate shortens s to width columns so that lines never wrap, which would throw off clear. Columns are counted as
+// runes, which is exact for the names of contexts and GVKs.
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) < width {
+		return s
+	}
+	return string(runes[:width-1])
+}
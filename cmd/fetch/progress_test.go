@@ -0,0 +1,115 @@
+package fetch
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/mlowery/mcfetcher/pkg/fetcher"
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+func TestProgressView_OnProgress(t *testing.T) {
+	var out, errOut bytes.Buffer
+	v := newProgressView(&out, &errOut, []string{"c1", "c2"}, 2)
+
+	v.OnProgress(&fetcher.Progress{Type: fetcher.ContextStarted, Context: "c1"})
+	v.OnProgress(&fetcher.Progress{Type: fetcher.ContextStarted, Context: "c2"})
+	v.OnProgress(&fetcher.Progress{Type: fetcher.GVKStarted, Context: "c1", GVK: "deployment.apps"})
+	v.OnProgress(&fetcher.Progress{Type: fetcher.GVKPage, Context: "c1", GVK: "deployment.apps", Pages: 2,
+		Listed: 1000})
+	// an unknown context is ignored
+	v.OnProgress(&fetcher.Progress{Type: fetcher.ContextStarted, Context: "c3"})
+	v.draw()
+	got := out.String()
+	for _, want := range []string{
+		"contexts: 0/2 done, 2 running, 0 failed; errors: 0\n",
+		"  c1  0/2 GVKs  listing deployment.apps: page 2, 1000 objects\n",
+		"  c2  0/2 GVKs\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("drew %q, want it to contain %q", got, want)
+		}
+	}
+	if v.lines != 3 {
+		t.Errorf("lines = %d, want 3", v.lines)
+	}
+
+	// errors are written above the view, which is cleared and drawn again
+	out.Reset()
+	v.OnProgress(&fetcher.Progress{Type: fetcher.GVKDone, Context: "c2", GVK: "configmap.",
+		Result: &fetcher.Result{Context: "c2", GVK: "configmap.", Err: errors.New("forbidden")}})
+	if got, want := errOut.String(), "error: forbidden\n"; got != want {
+		t.Errorf("wrote errors %q, want %q", got, want)
+	}
+	got = out.String()
+	if !strings.HasPrefix(got, "\x1b[3A\x1b[J") {
+		t.Errorf("drew %q, want it to clear the last 3 lines first", got)
+	}
+	if want := "  c2  1/2 GVKs  1 errors\n"; !strings.Contains(got, want) {
+		t.Errorf("drew %q, want it to contain %q", got, want)
+	}
+
+	out.Reset()
+	v.OnProgress(&fetcher.Progress{Type: fetcher.GVKDone, Context: "c1", GVK: "deployment.apps",
+		Result: &fetcher.Result{Context: "c1", GVK: "deployment.apps"}})
+	v.OnProgress(&fetcher.Progress{Type: fetcher.ContextDone, Context: "c2"})
+	v.draw()
+	got = out.String()
+	for _, want := range []string{
+		"contexts: 1/2 done, 1 running, 1 failed; errors: 1\n",
+		"  c1  1/2 GVKs\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("drew %q, want it to contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "  c2  ") {
+		t.Errorf("drew %q, want no line for the done context", got)
+	}
+}
+
+func TestProgressView_Write(t *testing.T) {
+	var out, errOut bytes.Buffer
+	v := newProgressView(&out, &errOut, []string{"c1"}, 1)
+	v.draw()
+
+	out.Reset()
+	logger := util.NewLoggerTo(v, zapcore.WarnLevel)
+	logger.Infow("listing")
+	logger.Warnw("retrying list", "attempt", 1)
+
+	got := errOut.String()
+	if !strings.Contains(got, `"msg":"retrying list"`) {
+		t.Errorf("logged %q, want the warning", got)
+	}
+	if strings.Contains(got, `"msg":"listing"`) {
+		t.Errorf("logged %q, want no info", got)
+	}
+	if !strings.HasPrefix(out.String(), "\x1b[1A\x1b[J") || v.lines != 1 {
+		t.Errorf("drew %q, want the view cleared and drawn again", out.String())
+	}
+}
+
+func Test_truncate(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{s: "short", width: 10, want: "short"},
+		{s: "exactly10!", width: 10, want: "exactly10"},
+		{s: "ctx-東京-prod", width: 8, want: "ctx-東京-"},
+		{s: "東京", width: 3, want: "東京"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			if got := truncate(tt.s, tt.width); got != tt.want {
+				t.Errorf("truncate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package presets
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mlowery/mcfetcher/pkg/config"
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "presets",
+	Short: "Inspect the built-in sanitization presets that GVK configs can reference with preset.",
+}
+
+var showCmd = &cobra.Command{
+	Use:       "show <name>",
+	Short:     "Print the rules of a preset as a GVK block of the config file.",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: config.PresetNames(),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, dFunc := util.NewLogger()
+		defer dFunc()
+
+		if err := config.WritePreset(os.Stdout, args[0]); err != nil {
+			logger.Errorf("failed to show preset: %v", err)
+			os.Exit(util.ExitConfigError)
+		}
+	},
+}
+
+func init() {
+	Cmd.AddCommand(showCmd)
+}
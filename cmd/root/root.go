@@ -2,14 +2,22 @@ package root
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/mlowery/mcfetcher/cmd/cache"
+	"github.com/mlowery/mcfetcher/cmd/drift"
+	"github.com/mlowery/mcfetcher/cmd/export"
 	"github.com/mlowery/mcfetcher/cmd/fetch"
+	"github.com/mlowery/mcfetcher/cmd/presets"
+	"github.com/mlowery/mcfetcher/cmd/serve"
+	"github.com/mlowery/mcfetcher/cmd/snapshots"
+	"github.com/mlowery/mcfetcher/cmd/table"
+	"github.com/mlowery/mcfetcher/cmd/watch"
+	"github.com/mlowery/mcfetcher/pkg/util"
 )
 
 var cfgFile string
@@ -23,9 +31,21 @@ var cmd = &cobra.Command{
 }
 
 func Execute() {
+	defer func() {
+		if r := recover(); r != nil {
+			// the config readers (e.g. config.ReadGVKOrDie) panic on invalid config; anything else is a bug
+			configErr, ok := r.(*util.ConfigError)
+			if !ok {
+				panic(r)
+			}
+			fmt.Fprintf(os.Stderr, "invalid config: %v\n", configErr)
+			os.Exit(util.ExitConfigError)
+		}
+	}()
+	// commands exit on their own so errors are only returned for bad flags and arguments
 	if err := cmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(util.ExitConfigError)
 	}
 }
 
@@ -35,19 +55,81 @@ func init() {
 	cmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file")
 	cmd.PersistentFlags().StringP("work-dir", "d", ".", "working directory")
 	viper.BindPFlag("work-dir", cmd.PersistentFlags().Lookup("work-dir"))
+
+	cmd.PersistentFlags().String("kubeconfig", "", "kubeconfig")
+	viper.BindPFlag("kubeconfig", cmd.PersistentFlags().Lookup("kubeconfig"))
+
+	cmd.PersistentFlags().StringSlice("kubeconfig-contexts", []string{}, "kubeconfig-contexts")
+	viper.BindPFlag("kubeconfig-contexts", cmd.PersistentFlags().Lookup("kubeconfig-contexts"))
+
+	cmd.PersistentFlags().String("inventory", "", "TOML or YAML file listing clusters with their kubeconfig, context, alias, and labels")
+	viper.BindPFlag("inventory", cmd.PersistentFlags().Lookup("inventory"))
+
+	cmd.PersistentFlags().String("cluster-selector", "", "label selector for inventory clusters (e.g. env=prod,region=eu)")
+	viper.BindPFlag("cluster-selector", cmd.PersistentFlags().Lookup("cluster-selector"))
+
+	// client settings apply to every cluster; inventory clusters can override them
+	cmd.PersistentFlags().String("as", "", "user to impersonate")
+	viper.BindPFlag("client.as", cmd.PersistentFlags().Lookup("as"))
+	cmd.PersistentFlags().StringSlice("as-group", []string{}, "groups to impersonate")
+	viper.BindPFlag("client.as-groups", cmd.PersistentFlags().Lookup("as-group"))
+	cmd.PersistentFlags().Float32("qps", 0, "maximum queries per second to each API server (0 for the client-go default)")
+	viper.BindPFlag("client.qps", cmd.PersistentFlags().Lookup("qps"))
+	cmd.PersistentFlags().Int("burst", 0, "maximum burst of queries to each API server (0 for the client-go default)")
+	viper.BindPFlag("client.burst", cmd.PersistentFlags().Lookup("burst"))
+	cmd.PersistentFlags().String("tls-server-name", "", "server name to use for API server certificate validation")
+	viper.BindPFlag("client.tls-server-name", cmd.PersistentFlags().Lookup("tls-server-name"))
+	cmd.PersistentFlags().String("proxy", "", "HTTP(S) proxy URL for API server requests")
+	viper.BindPFlag("client.proxy", cmd.PersistentFlags().Lookup("proxy"))
+	cmd.PersistentFlags().Float64("rate-limit-qps", 0, "requests per second to each cluster, shared by discovery and lists (0 for no limit)")
+	viper.BindPFlag("client.rate-limit-qps", cmd.PersistentFlags().Lookup("rate-limit-qps"))
+	cmd.PersistentFlags().Int("rate-limit-burst", 0, "burst of requests to each cluster (defaults to rate-limit-qps)")
+	viper.BindPFlag("client.rate-limit-burst", cmd.PersistentFlags().Lookup("rate-limit-burst"))
+
+	cmd.PersistentFlags().Float64("global-rate-limit-qps", 0, "requests per second across all clusters (0 for no limit)")
+	viper.BindPFlag("global-rate-limit-qps", cmd.PersistentFlags().Lookup("global-rate-limit-qps"))
+	cmd.PersistentFlags().Int("global-rate-limit-burst", 0, "burst of requests across all clusters (defaults to global-rate-limit-qps)")
+	viper.BindPFlag("global-rate-limit-burst", cmd.PersistentFlags().Lookup("global-rate-limit-burst"))
+
+	cmd.PersistentFlags().String("log-level", "info", "minimum level to log: debug, info, warn, or error")
+	viper.BindPFlag("log-level", cmd.PersistentFlags().Lookup("log-level"))
+	cmd.PersistentFlags().String("log-format", "",
+		"json or console to always log; by default fetch shows a progress view when stdout is a terminal and logs JSON otherwise")
+	viper.BindPFlag("log-format", cmd.PersistentFlags().Lookup("log-format"))
+	cmd.PersistentFlags().String("log-file", "", "file to append logs to instead of stdout and stderr")
+	viper.BindPFlag("log-file", cmd.PersistentFlags().Lookup("log-file"))
+	for _, component := range []string{util.ComponentClient, util.ComponentSanitize, util.ComponentCache} {
+		flag := "log-level-" + component
+		cmd.PersistentFlags().String(flag, "", fmt.Sprintf("minimum level to log for %s (defaults to log-level)", component))
+		viper.BindPFlag(flag, cmd.PersistentFlags().Lookup(flag))
+	}
+
+	cmd.PersistentFlags().String("cache-compression", "none",
+		"compression of written cache files: none, gzip, or zstd (files in any compression are read)")
+	viper.BindPFlag("cache-compression", cmd.PersistentFlags().Lookup("cache-compression"))
+
 	cmd.AddCommand(fetch.Cmd)
+	cmd.AddCommand(presets.Cmd)
+	cmd.AddCommand(cache.Cmd)
+	cmd.AddCommand(drift.Cmd)
+	cmd.AddCommand(export.Cmd)
+	cmd.AddCommand(serve.Cmd)
+	cmd.AddCommand(snapshots.Cmd)
+	cmd.AddCommand(table.Cmd)
+	cmd.AddCommand(watch.Cmd)
 }
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
 	viper.AutomaticEnv() // read in environment variables that match
-	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	// keys of config sections like client.qps are MCFETCHER_CLIENT_QPS
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_", ".", "_"))
 	viper.SetEnvPrefix("mcfetcher")
 	if cfgFile != "" {
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
 		if err := viper.ReadInConfig(); err != nil {
-			log.Fatalf("failed to read config file: %v", err)
+			panic(util.ConfigErrorf("failed to read config file: %v", err))
 		}
 	}
 }
@@ -0,0 +1,266 @@
+package serve
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/mlowery/mcfetcher/pkg/cache"
+	"github.com/mlowery/mcfetcher/pkg/config"
+	oerrors "github.com/mlowery/mcfetcher/pkg/errors"
+	"github.com/mlowery/mcfetcher/pkg/metrics"
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the sanitized cache over a read-only HTTP JSON API.",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, dFunc := util.NewLogger()
+		defer dFunc()
+
+		workDir, err := util.EnsureWorkDir()
+		if err != nil {
+			logger.Fatalf("failed to ensure work dir: %v", err)
+		}
+		listen := config.ReadString("listen", ":8080")
+
+		s := &server{
+			logger:  logger,
+			store:   cache.NewFileStore(workDir),
+			entries: map[string]*entry{},
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/v1/contexts", s.handleContexts)
+		mux.HandleFunc("/api/v1/gvks", s.handleGVKs)
+		mux.HandleFunc("/api/v1/objects", s.handleObjects)
+		mux.HandleFunc("/api/v1/object", s.handleObject)
+		mux.Handle("/metrics", metrics.Handler())
+
+		logger.Infow("serving", "listen", listen, "workDir", workDir)
+		if err := http.ListenAndServe(listen, mux); err != nil {
+			logger.Fatalf("failed to serve: %v", err)
+		}
+	},
+}
+
+// entry is one parsed cache file.
+type entry struct {
+	modTime time.Time
+	size    int64
+	objs    []*unstructured.Unstructured
+	// err is why the file couldn't be parsed; it is retried once the file changes
+	err error
+}
+
+type server struct {
+	logger *zap.SugaredLogger
+	store  *cache.FileStore
+
+	mu sync.Mutex
+	// keyed by path
+	entries map[string]*entry
+}
+
+// object is how objects are returned by the API.
+type object struct {
+	Context string                     `json:"context"`
+	GVK     string                     `json:"gvk"`
+	Object  *unstructured.Unstructured `json:"object"`
+}
+
+// load returns the cache files in the work dir along with their objects. Files are only parsed again when their
+// modification time or size changes, so updates by fetch or watch are picked up on the next request. Files that
+// can't be read are logged once and left out so that the rest are still served; files removed since they were listed
+// (e.g. by cache rm) are left out quietly.
+func (s *server) load() ([]*cache.Entry, map[string][]*unstructured.Unstructured, error) {
+	files, err := s.store.List()
+	if err != nil {
+		return nil, nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loaded := make([]*cache.Entry, 0, len(files))
+	objs := make(map[string][]*unstructured.Unstructured, len(files))
+	seen := make(map[string]bool, len(files))
+	for _, f := range files {
+		info, err := os.Stat(f.Path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		seen[f.Path] = true
+		if err != nil {
+			if _, ok := s.entries[f.Path]; !ok {
+				s.logLoadError(f, err)
+				s.entries[f.Path] = &entry{err: err}
+			}
+			continue
+		}
+		e, ok := s.entries[f.Path]
+		if !ok || !e.modTime.Equal(info.ModTime()) || e.size != info.Size() {
+			l, err := s.store.Get(f.Context, f.GVK)
+			if os.IsNotExist(errors.Cause(err)) {
+				delete(s.entries, f.Path)
+				continue
+			}
+			e = &entry{modTime: info.ModTime(), size: info.Size(), objs: l, err: err}
+			s.entries[f.Path] = e
+			if err != nil {
+				s.logLoadError(f, err)
+			} else {
+				metrics.CacheLoads.WithLabelValues(f.Context, f.GVK).Inc()
+				s.logger.Infow("loaded", "filename", f.Path, "sanitizedObjCount", len(l))
+			}
+		}
+		if e.err != nil {
+			continue
+		}
+		loaded = append(loaded, f)
+		objs[f.Path] = e.objs
+	}
+	for path := range s.entries {
+		if !seen[path] {
+			delete(s.entries, path)
+		}
+	}
+	return loaded, objs, nil
+}
+
+func (s *server) logLoadError(f *cache.Entry, err error) {
+	oerr := oerrors.New(err, "failed to load cache file; skipping it", "filename", f.Path).
+		WithClass(oerrors.ClassCache)
+	metrics.Errors.WithLabelValues(f.Context, f.GVK, string(oerr.Class())).Inc()
+	s.logger.Errorw(oerr.Error(), "class", oerr.Class())
+}
+
+func (s *server) handleContexts(w http.ResponseWriter, r *http.Request) {
+	files, _, err := s.load()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.writeJSON(w, uniqueSorted(files, func(f *cache.Entry) string { return f.Context }))
+}
+
+func (s *server) handleGVKs(w http.ResponseWriter, r *http.Request) {
+	files, _, err := s.load()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.writeJSON(w, uniqueSorted(files, func(f *cache.Entry) string { return f.GVK }))
+}
+
+// handleObjects lists objects. Supported query parameters are context, gvk, namespace, name, and labelSelector;
+// all are optional.
+func (s *server) handleObjects(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	selector, err := labels.Parse(q.Get("labelSelector"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, errors.Wrapf(err, "invalid labelSelector"))
+		return
+	}
+	files, objs, err := s.load()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	result := []*object{}
+	for _, f := range files {
+		if !matches(q.Get("context"), f.Context) || !matches(q.Get("gvk"), f.GVK) {
+			continue
+		}
+		for _, obj := range objs[f.Path] {
+			if !matches(q.Get("namespace"), obj.GetNamespace()) || !matches(q.Get("name"), obj.GetName()) {
+				continue
+			}
+			if !selector.Matches(labels.Set(obj.GetLabels())) {
+				continue
+			}
+			result = append(result, &object{Context: f.Context, GVK: f.GVK, Object: obj})
+		}
+	}
+	s.writeJSON(w, result)
+}
+
+// handleObject returns one object from every context side by side, keyed by context. gvk and name are required;
+// namespace is required for namespaced objects.
+func (s *server) handleObject(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	gvk, namespace, name := q.Get("gvk"), q.Get("namespace"), q.Get("name")
+	if len(gvk) == 0 || len(name) == 0 {
+		s.writeError(w, http.StatusBadRequest, errors.Errorf("gvk and name are required"))
+		return
+	}
+	files, objs, err := s.load()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	result := map[string]*unstructured.Unstructured{}
+	for _, f := range files {
+		if f.GVK != gvk {
+			continue
+		}
+		for _, obj := range objs[f.Path] {
+			if obj.GetNamespace() == namespace && obj.GetName() == name {
+				result[f.Context] = obj
+				break
+			}
+		}
+	}
+	if len(result) == 0 {
+		s.writeError(w, http.StatusNotFound, errors.Errorf("object not found in any context"))
+		return
+	}
+	s.writeJSON(w, result)
+}
+
+func (s *server) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Warnf("failed to write response: %v", err)
+	}
+}
+
+func (s *server) writeError(w http.ResponseWriter, code int, err error) {
+	if code >= http.StatusInternalServerError {
+		s.logger.Errorw(err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// matches returns true if want is empty or equal to got.
+func matches(want, got string) bool {
+	return len(want) == 0 || want == got
+}
+
+func uniqueSorted(files []*cache.Entry, f func(*cache.Entry) string) []string {
+	set := map[string]bool{}
+	for _, file := range files {
+		set[f(file)] = true
+	}
+	l := make([]string, 0, len(set))
+	for s := range set {
+		l = append(l, s)
+	}
+	sort.Strings(l)
+	return l
+}
+
+func init() {
+	Cmd.Flags().String("listen", ":8080", "address to listen on")
+	viper.BindPFlag("listen", Cmd.Flags().Lookup("listen"))
+}
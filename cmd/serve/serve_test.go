@@ -0,0 +1,165 @@
+package serve
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/mlowery/mcfetcher/pkg/cache"
+)
+
+func newNamespace(name string, labels map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("Namespace")
+	obj.SetName(name)
+	obj.SetLabels(labels)
+	return obj
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, string, func()) {
+	dir, err := ioutil.TempDir("", "mcfetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := cache.NewFileStore(dir)
+	if err := store.Put("c1", "namespace.", []*unstructured.Unstructured{
+		newNamespace("a", map[string]string{"env": "prod"}), newNamespace("b", nil)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put("c2", "namespace.", []*unstructured.Unstructured{newNamespace("a", nil)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	s := &server{logger: zap.NewNop().Sugar(), store: store, entries: map[string]*entry{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/contexts", s.handleContexts)
+	mux.HandleFunc("/api/v1/gvks", s.handleGVKs)
+	mux.HandleFunc("/api/v1/objects", s.handleObjects)
+	mux.HandleFunc("/api/v1/object", s.handleObject)
+	ts := httptest.NewServer(mux)
+	return ts, dir, func() {
+		ts.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func get(t *testing.T, url string, v interface{}) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestServer_handlers(t *testing.T) {
+	ts, _, cleanup := newTestServer(t)
+	defer cleanup()
+
+	var contexts []string
+	if code := get(t, ts.URL+"/api/v1/contexts", &contexts); code != http.StatusOK {
+		t.Errorf("contexts code = %d", code)
+	}
+	if want := []string{"c1", "c2"}; !reflect.DeepEqual(contexts, want) {
+		t.Errorf("contexts = %v, want %v", contexts, want)
+	}
+	var gvks []string
+	get(t, ts.URL+"/api/v1/gvks", &gvks)
+	if want := []string{"namespace."}; !reflect.DeepEqual(gvks, want) {
+		t.Errorf("gvks = %v, want %v", gvks, want)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"c1/a", "c1/b", "c2/a"}},
+		{"?context=c2", []string{"c2/a"}},
+		{"?name=a", []string{"c1/a", "c2/a"}},
+		{"?labelSelector=env%3Dprod", []string{"c1/a"}},
+		{"?gvk=pod.", nil},
+	}
+	for _, tt := range tests {
+		t.Run("objects"+tt.query, func(t *testing.T) {
+			var objs []*object
+			if code := get(t, ts.URL+"/api/v1/objects"+tt.query, &objs); code != http.StatusOK {
+				t.Errorf("code = %d", code)
+			}
+			var got []string
+			for _, o := range objs {
+				got = append(got, o.Context+"/"+o.Object.GetName())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("objects = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var byContext map[string]*unstructured.Unstructured
+	if code := get(t, ts.URL+"/api/v1/object?gvk=namespace.&name=a", &byContext); code != http.StatusOK {
+		t.Errorf("object code = %d", code)
+	}
+	if len(byContext) != 2 || byContext["c1"] == nil || byContext["c2"] == nil {
+		t.Errorf("object = %v, want c1 and c2", byContext)
+	}
+	var errResp map[string]string
+	if code := get(t, ts.URL+"/api/v1/object?gvk=namespace.&name=missing", &errResp); code != http.StatusNotFound {
+		t.Errorf("missing object code = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := get(t, ts.URL+"/api/v1/object?gvk=namespace.", &errResp); code != http.StatusBadRequest {
+		t.Errorf("object without name code = %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestServer_corruptFile(t *testing.T) {
+	ts, dir, cleanup := newTestServer(t)
+	defer cleanup()
+	if err := ioutil.WriteFile(filepath.Join(dir, "namespace.", "c3.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the corrupt file is skipped and the rest are served
+	for i := 0; i < 2; i++ {
+		var contexts []string
+		if code := get(t, ts.URL+"/api/v1/contexts", &contexts); code != http.StatusOK {
+			t.Errorf("contexts code = %d, want %d", code, http.StatusOK)
+		}
+		if want := []string{"c1", "c2"}; !reflect.DeepEqual(contexts, want) {
+			t.Errorf("contexts = %v, want %v", contexts, want)
+		}
+	}
+	var objs []*object
+	if code := get(t, ts.URL+"/api/v1/objects", &objs); code != http.StatusOK || len(objs) != 3 {
+		t.Errorf("objects code = %d, count = %d, want %d and 3", code, len(objs), http.StatusOK)
+	}
+
+	// fixing the file makes it served again
+	if err := ioutil.WriteFile(filepath.Join(dir, "namespace.", "c3.json"), []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var contexts []string
+	get(t, ts.URL+"/api/v1/contexts", &contexts)
+	if want := []string{"c1", "c2", "c3"}; !reflect.DeepEqual(contexts, want) {
+		t.Errorf("contexts after fix = %v, want %v", contexts, want)
+	}
+
+	// a removed file is dropped
+	if err := os.Remove(filepath.Join(dir, "namespace.", "c3.json")); err != nil {
+		t.Fatal(err)
+	}
+	get(t, ts.URL+"/api/v1/contexts", &contexts)
+	if want := []string{"c1", "c2"}; !reflect.DeepEqual(contexts, want) {
+		t.Errorf("contexts after remove = %v, want %v", contexts, want)
+	}
+}
@@ -0,0 +1,224 @@
+package snapshots
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/mlowery/mcfetcher/pkg/cache"
+	"github.com/mlowery/mcfetcher/pkg/config"
+	oerrors "github.com/mlowery/mcfetcher/pkg/errors"
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "List, prune, and compare snapshots written by fetch --snapshot.",
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List snapshots, oldest first.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, dFunc := util.NewLogger()
+		defer dFunc()
+
+		workDir, err := util.EnsureWorkDir()
+		if err != nil {
+			logger.Fatalf("failed to ensure work dir: %v", err)
+		}
+		snapshots, err := util.ListSnapshots(workDir)
+		if err != nil {
+			logger.Fatalf("failed to list snapshots: %v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tAGE\tSIZE")
+		for _, s := range snapshots {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", s.Name, time.Since(s.Time).Round(time.Second), s.Size)
+		}
+		w.Flush()
+	},
+}
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete old snapshots.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, dFunc := util.NewLogger()
+		defer dFunc()
+
+		keep := viper.GetInt("keep")
+		olderThan := viper.GetDuration("older-than")
+		if keep <= 0 && olderThan <= 0 {
+			logger.Fatalf("one of keep or older-than is required")
+		}
+
+		workDir, err := util.EnsureWorkDir()
+		if err != nil {
+			logger.Fatalf("failed to ensure work dir: %v", err)
+		}
+		unlock, err := util.LockWorkDir(workDir)
+		if err != nil {
+			logger.Fatalf("failed to lock work dir: %v", err)
+		}
+		defer unlock()
+
+		snapshots, err := util.ListSnapshots(workDir)
+		if err != nil {
+			logger.Fatalf("failed to list snapshots: %v", err)
+		}
+		for _, s := range selectPrunable(snapshots, keep, olderThan, time.Now()) {
+			// a snapshot is locked by fetch --snapshot while it is written; once the lock is free it is never written
+			// again, so it can be removed after releasing the lock
+			unlockSnapshot, err := util.LockWorkDir(s.Dir)
+			if errors.Cause(err) == util.ErrLocked {
+				logger.Warnw("skipping snapshot being written", "snapshot", s.Name)
+				continue
+			} else if err != nil {
+				logger.Fatalf("failed to lock snapshot %q: %v", s.Name, err)
+			}
+			unlockSnapshot()
+			logger.Infow("pruning snapshot", "snapshot", s.Name)
+			if err := os.RemoveAll(s.Dir); err != nil {
+				logger.Fatalf("failed to remove snapshot %q: %v", s.Name, err)
+			}
+		}
+	},
+}
+
+// selectPrunable returns the snapshots that neither keep nor olderThan keep at now. snapshots are oldest first, as
+// returned by util.ListSnapshots. keep and olderThan are ignored if they are not positive.
+func selectPrunable(snapshots []*util.Snapshot, keep int, olderThan time.Duration, now time.Time) []*util.Snapshot {
+	var prunable []*util.Snapshot
+	for i, s := range snapshots {
+		keptByCount := keep > 0 && i >= len(snapshots)-keep
+		keptByAge := olderThan > 0 && now.Sub(s.Time) < olderThan
+		if !keptByCount && !keptByAge {
+			prunable = append(prunable, s)
+		}
+	}
+	return prunable
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <old-snapshot> <new-snapshot>",
+	Short: "Show objects added, removed, and changed between two snapshots.",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, dFunc := util.NewLogger()
+		defer dFunc()
+
+		gvkConfigs := config.ReadGVKOrDie()
+		contexts := config.ClusterNames(config.ReadClustersOrDie())
+
+		workDir, err := util.EnsureWorkDir()
+		if err != nil {
+			logger.Fatalf("failed to ensure work dir: %v", err)
+		}
+		oldDir, err := util.SnapshotDir(workDir, args[0])
+		if err != nil {
+			logger.Fatalf("failed to find old snapshot: %v", err)
+		}
+		newDir, err := util.SnapshotDir(workDir, args[1])
+		if err != nil {
+			logger.Fatalf("failed to find new snapshot: %v", err)
+		}
+
+		var errorCount, comparedCount, changeCount int
+		for gvkString := range gvkConfigs {
+			for _, context := range contexts {
+				logger := logger.With("gvk", gvkString, "context", context)
+				oldObjs, oldAbsent, err := readSnapshot(oldDir, context, gvkString)
+				if err != nil {
+					errorCount++
+					logger.Errorw(oerrors.New(err, "failed to read old snapshot",
+						"gvk", gvkString, "context", context, "snapshot", args[0]).Error())
+					continue
+				}
+				newObjs, newAbsent, err := readSnapshot(newDir, context, gvkString)
+				if err != nil {
+					errorCount++
+					logger.Errorw(oerrors.New(err, "failed to read new snapshot",
+						"gvk", gvkString, "context", context, "snapshot", args[1]).Error())
+					continue
+				}
+				comparedCount++
+				if oldAbsent && !newAbsent {
+					changeCount++
+					logger.Infow("change", "type", "served")
+				} else if !oldAbsent && newAbsent {
+					changeCount++
+					logger.Infow("change", "type", "not-served")
+				}
+				d := util.DiffObjects(oldObjs, newObjs)
+				for _, key := range d.Missing {
+					logger.Infow("change", "type", "removed", "key", key)
+				}
+				for _, key := range d.Extra {
+					logger.Infow("change", "type", "added", "key", key)
+				}
+				for key, paths := range d.Differing {
+					logger.Infow("change", "type", "changed", "key", key, "paths", paths)
+				}
+				changeCount += len(d.Missing) + len(d.Extra) + len(d.Differing)
+				for key, m := range d.VersionMismatch {
+					logger.Infow("change", "type", "version", "key", key, "oldVersion", m.Want, "newVersion", m.Got)
+					// an object is one change however many ways it changed
+					if _, ok := d.Differing[key]; !ok {
+						changeCount++
+					}
+				}
+			}
+		}
+
+		// errors win over changes since the changes are incomplete
+		if errorCount > 0 {
+			logger.Infof("failed with %d errors (written to stderr)", errorCount)
+			if comparedCount == 0 {
+				os.Exit(util.ExitFailure)
+			}
+			os.Exit(util.ExitPartialFailure)
+		}
+		if changeCount > 0 {
+			logger.Infof("found %d changes", changeCount)
+			os.Exit(util.ExitDrift)
+		}
+	},
+}
+
+// readSnapshot returns the objects of context and gvkString in the snapshot at dir and whether the GVK was absent
+// (not served by the cluster).
+func readSnapshot(dir, context, gvkString string) ([]*unstructured.Unstructured, bool, error) {
+	store := cache.NewFileStore(dir)
+	objs, err := store.Get(context, gvkString)
+	if err != nil {
+		return nil, false, err
+	}
+	if objs == nil {
+		return nil, false, oerrors.New(nil, "not in snapshot", "dir", dir)
+	}
+	meta, err := store.GetMeta(context, gvkString)
+	if err != nil {
+		return nil, false, err
+	}
+	return objs, meta != nil && meta.Absent, nil
+}
+
+func init() {
+	pruneCmd.Flags().Int("keep", 0, "number of most recent snapshots to keep")
+	viper.BindPFlag("keep", pruneCmd.Flags().Lookup("keep"))
+	pruneCmd.Flags().Duration("older-than", 0, "delete snapshots older than this (snapshots kept by --keep are never deleted)")
+	viper.BindPFlag("older-than", pruneCmd.Flags().Lookup("older-than"))
+
+	Cmd.AddCommand(listCmd)
+	Cmd.AddCommand(pruneCmd)
+	Cmd.AddCommand(diffCmd)
+}
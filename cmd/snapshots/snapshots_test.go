@@ -0,0 +1,64 @@
+package snapshots
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+func Test_selectPrunable(t *testing.T) {
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	workDir, err := ioutil.TempDir("", "mcfetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workDir)
+	// 9, 5, 2, and 0 days old, created out of order
+	ages := []int{2, 9, 0, 5}
+	for _, days := range ages {
+		name := util.NewSnapshotName(now.AddDate(0, 0, -days))
+		if err := os.MkdirAll(filepath.Join(workDir, util.SnapshotsDir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshots, err := util.ListSnapshots(workDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := func(days int) string {
+		return util.NewSnapshotName(now.AddDate(0, 0, -days))
+	}
+
+	day := 24 * time.Hour
+	tests := []struct {
+		name      string
+		keep      int
+		olderThan time.Duration
+		want      []string
+	}{
+		{name: "keep", keep: 2, want: []string{name(9), name(5)}},
+		{name: "keep all", keep: 4},
+		{name: "keep more than all", keep: 10},
+		{name: "older than", olderThan: 3 * day, want: []string{name(9), name(5)}},
+		{name: "older than exactly", olderThan: 5 * day, want: []string{name(9), name(5)}},
+		{name: "older than none", olderThan: 10 * day},
+		{name: "kept by count though old", keep: 3, olderThan: day, want: []string{name(9)}},
+		{name: "kept by age though over count", keep: 1, olderThan: 6 * day, want: []string{name(9)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, s := range selectPrunable(snapshots, tt.keep, tt.olderThan, now) {
+				got = append(got, s.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectPrunable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package table
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/mlowery/mcfetcher/pkg/cache"
+	"github.com/mlowery/mcfetcher/pkg/config"
+	oerrors "github.com/mlowery/mcfetcher/pkg/errors"
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+const (
+	formatText     = "text"
+	formatCSV      = "csv"
+	formatMarkdown = "markdown"
+
+	// shown for paths that don't exist, like kubectl
+	noneValue = "<none>"
+)
+
+// defaultColumns are used for GVKs without a columns config.
+var defaultColumns = []config.Column{
+	{Name: "NAMESPACE", Path: "/metadata/namespace"},
+	{Name: "NAME", Path: "/metadata/name"},
+}
+
+var Cmd = &cobra.Command{
+	Use:   "table <gvk>",
+	Short: "Print the cached objects of a GVK as a table with one row per (context, object).",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, dFunc := util.NewLogger()
+		defer dFunc()
+
+		gvkConfigs := config.ReadGVKOrDie()
+		contexts := config.ClusterNames(config.ReadClustersOrDie())
+		format := config.ReadString("format", formatText)
+
+		gvkString := args[0]
+		gvkConfig, ok := gvkConfigs[gvkString]
+		if !ok {
+			logger.Fatalf("gvk %q is not configured", gvkString)
+		}
+		columns := gvkConfig.Columns
+		if len(columns) == 0 {
+			columns = defaultColumns
+		}
+
+		workDir, err := util.EnsureWorkDir()
+		if err != nil {
+			logger.Fatalf("failed to ensure work dir: %v", err)
+		}
+		store := cache.NewFileStore(workDir)
+
+		header := []string{"CONTEXT"}
+		for _, c := range columns {
+			header = append(header, c.Name)
+		}
+		var rows [][]string
+		var errorCount, readCount int
+		for _, context := range contexts {
+			objs, err := store.Get(context, gvkString)
+			if err != nil {
+				errorCount++
+				logger.Errorw(oerrors.New(err, "failed to read cached records",
+					"gvk", gvkString, "context", context).Error())
+				continue
+			}
+			readCount++
+			if objs == nil {
+				logger.Warnw("no cached records (run fetch first)", "context", context, "gvk", gvkString)
+				continue
+			}
+			sort.Slice(objs, func(i, j int) bool {
+				return util.ObjectKey(objs[i]) < util.ObjectKey(objs[j])
+			})
+			for _, obj := range objs {
+				row := []string{context}
+				for _, c := range columns {
+					row = append(row, formatValue(util.LookupPath(obj.Object, c.Path)))
+				}
+				rows = append(rows, row)
+			}
+		}
+
+		switch format {
+		case formatText:
+			err = writeText(os.Stdout, header, rows)
+		case formatCSV:
+			err = writeCSV(os.Stdout, header, rows)
+		case formatMarkdown:
+			err = writeMarkdown(os.Stdout, header, rows)
+		default:
+			logger.Fatalf("unknown format %q", format)
+		}
+		if err != nil {
+			logger.Fatalf("failed to write table: %v", err)
+		}
+
+		if errorCount > 0 {
+			logger.Infof("failed with %d errors (written to stderr)", errorCount)
+			if readCount == 0 {
+				os.Exit(util.ExitFailure)
+			}
+			os.Exit(util.ExitPartialFailure)
+		}
+	},
+}
+
+func formatValue(v interface{}, found bool) string {
+	if !found || v == nil {
+		return noneValue
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+func writeText(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func writeCSV(w io.Writer, header []string, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func writeMarkdown(w io.Writer, header []string, rows [][]string) error {
+	writeRow := func(cells []string) error {
+		escaped := make([]string, len(cells))
+		for i, c := range cells {
+			escaped[i] = strings.Replace(c, "|", `\|`, -1)
+		}
+		_, err := fmt.Fprintf(w, "| %s |\n", strings.Join(escaped, " | "))
+		return err
+	}
+	if err := writeRow(header); err != nil {
+		return err
+	}
+	sep := make([]string, len(header))
+	for i := range sep {
+		sep[i] = "---"
+	}
+	if err := writeRow(sep); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writeRow(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	Cmd.Flags().String("format", formatText, "output format: text, csv, or markdown")
+	viper.BindPFlag("format", Cmd.Flags().Lookup("format"))
+}
@@ -0,0 +1,68 @@
+package table
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func Test_formatValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		v     interface{}
+		found bool
+		want  string
+	}{
+		{name: "missing", want: noneValue},
+		{name: "nil", found: true, want: noneValue},
+		{name: "string", v: "a", found: true, want: "a"},
+		{name: "empty string", v: "", found: true, want: ""},
+		{name: "int", v: int64(3), found: true, want: "3"},
+		{name: "bool", v: false, found: true, want: "false"},
+		{name: "map", v: map[string]interface{}{"b": "2", "a": int64(1)}, found: true, want: `{"a":1,"b":"2"}`},
+		{name: "list", v: []interface{}{"a", nil}, found: true, want: `["a",null]`},
+		{name: "not json", v: math.Inf(1), found: true, want: "+Inf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatValue(tt.v, tt.found); got != tt.want {
+				t.Errorf("formatValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+var (
+	testHeader = []string{"CONTEXT", "NAME"}
+	testRows   = [][]string{
+		{"c1", "a|b"},
+		{"c2", `with "quotes", and commas`},
+	}
+)
+
+func Test_writeMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeMarkdown(&buf, testHeader, testRows); err != nil {
+		t.Fatalf("writeMarkdown() error = %v", err)
+	}
+	want := "| CONTEXT | NAME |\n" +
+		"| --- | --- |\n" +
+		"| c1 | a\\|b |\n" +
+		"| c2 | with \"quotes\", and commas |\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeMarkdown() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func Test_writeCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, testHeader, testRows); err != nil {
+		t.Fatalf("writeCSV() error = %v", err)
+	}
+	want := "CONTEXT,NAME\n" +
+		"c1,a|b\n" +
+		"c2,\"with \"\"quotes\"\", and commas\"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeCSV() =\n%s\nwant\n%s", got, want)
+	}
+}
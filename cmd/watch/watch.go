@@ -0,0 +1,416 @@
+package watch
+
+import (
+	ctx "context"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/transport"
+
+	"github.com/mlowery/mcfetcher/pkg/cache"
+	dynamic2 "github.com/mlowery/mcfetcher/pkg/client/dynamic"
+	"github.com/mlowery/mcfetcher/pkg/config"
+	oerrors "github.com/mlowery/mcfetcher/pkg/errors"
+	"github.com/mlowery/mcfetcher/pkg/metrics"
+	"github.com/mlowery/mcfetcher/pkg/ratelimit"
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+const (
+	eventAdd    = "add"
+	eventUpdate = "update"
+	eventDelete = "delete"
+)
+
+// event is one line of the NDJSON output.
+type event struct {
+	Type      string                     `json:"type"`
+	Time      time.Time                  `json:"time"`
+	Cluster   string                     `json:"cluster"`
+	GVK       string                     `json:"gvk"`
+	Namespace string                     `json:"namespace,omitempty"`
+	Name      string                     `json:"name"`
+	Object    *unstructured.Unstructured `json:"object,omitempty"`
+}
+
+// eventWriter serializes events from all trackers onto one stream.
+type eventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (w *eventWriter) write(e *event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(e)
+}
+
+// newLoggerAndEvents returns the logger and an eventWriter appending to output (- for stdout) and a func that should be
+// called with defer. Logs never go to stdout when events do so that the output can be piped into NDJSON tools.
+func newLoggerAndEvents(output string) (*zap.SugaredLogger, *eventWriter, func()) {
+	if output == "-" {
+		logger, dFunc := util.NewStderrLogger()
+		return logger, &eventWriter{enc: json.NewEncoder(os.Stdout)}, dFunc
+	}
+	logger, dFunc := util.NewLogger()
+	f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		logger.Fatalf("failed to open output: %v", err)
+	}
+	return logger, &eventWriter{enc: json.NewEncoder(f)}, func() {
+		f.Close()
+		dFunc()
+	}
+}
+
+var Cmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Keep sanitized caches current and stream changes as NDJSON.",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, events, dFunc := newLoggerAndEvents(config.ReadString("output", "-"))
+		defer dFunc()
+
+		gvkConfigs := config.ReadGVKOrDie()
+		clusters := config.ReadClustersOrDie()
+		flushInterval := viper.GetDuration("flush-interval")
+		if flushInterval <= 0 {
+			logger.Errorf("flush-interval must be positive: %v", flushInterval)
+			os.Exit(util.ExitConfigError)
+		}
+
+		workDir, err := util.EnsureWorkDir()
+		if err != nil {
+			logger.Fatalf("failed to ensure work dir: %v", err)
+		}
+		unlock, err := util.LockWorkDir(workDir)
+		if err != nil {
+			logger.Fatalf("failed to lock work dir: %v", err)
+		}
+		defer unlock()
+		compression, err := util.ParseCompression(config.ReadString("cache-compression", ""))
+		if err != nil {
+			logger.Fatalf("failed to parse cache compression: %v", err)
+		}
+		store := cache.NewCompressedFileStore(workDir, compression)
+
+		if metricsAddr := config.ReadString("metrics-addr", ""); len(metricsAddr) > 0 {
+			go func() {
+				logger.Infow("serving metrics", "listen", metricsAddr)
+				if err := metrics.Serve(metricsAddr); err != nil {
+					logger.Fatalf("failed to serve metrics: %v", err)
+				}
+			}()
+		}
+
+		c, cancel := ctx.WithCancel(ctx.Background())
+		defer cancel()
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			sig := <-sigCh
+			logger.Infow("stopping", "signal", sig.String())
+			cancel()
+		}()
+
+		globalLimiter := ratelimit.New(viper.GetFloat64("global-rate-limit-qps"),
+			config.ReadInt("global-rate-limit-burst"))
+		var trackers []*tracker
+		var errorCount int
+		for _, cluster := range clusters {
+			context := cluster.Name
+			logger := logger.With("context", context)
+			kubeconfig := cluster.Kubeconfig
+			if len(kubeconfig) == 0 {
+				kubeconfig = config.ReadString("kubeconfig", util.InHomeDirOrDie(".kube/config"))
+			}
+			restConfig, err := dynamic2.ClientConfig(cluster.Context, kubeconfig).ClientConfig()
+			if err != nil {
+				errorCount++
+				logger.Errorw(oerrors.New(err, "failed to get rest config", "context", context).Error())
+				continue
+			}
+			if err := dynamic2.ApplySettings(restConfig, cluster.Client); err != nil {
+				errorCount++
+				logger.Errorw(oerrors.New(err, "failed to apply client settings", "context", context).Error())
+				continue
+			}
+			waiter := ratelimit.NewWaiter(ratelimit.New(cluster.Client.RateLimitQPS, cluster.Client.RateLimitBurst),
+				globalLimiter)
+			restConfig.WrapTransport = transport.Wrappers(restConfig.WrapTransport, waiter.WrapTransport)
+			client, err := dynamic2.New(restConfig)
+			if err != nil {
+				errorCount++
+				logger.Errorw(oerrors.New(err, "failed to create client (is proxy configured correctly?)",
+					"context", context).Error())
+				continue
+			}
+			factory := client.NewInformerFactory(0)
+			for gvkString, gvkConfig := range gvkConfigs {
+				logger := logger.With("gvk", gvkString)
+				gvr, err := client.Resource(gvkConfig.GroupVersionKind, gvkConfig.Versions)
+				if err != nil && !gvkConfig.Required && oerrors.Classify(err) == oerrors.ClassNoKindMatch {
+					// not watched until the next start, same as fetch
+					logger.Infow("not served; recording as absent (set required to make this an error)")
+					meta := &cache.Meta{ConfigHash: gvkConfig.Hash, Labels: cluster.Labels, Absent: true}
+					if err := store.Put(context, gvkString, nil, meta); err != nil {
+						errorCount++
+						err := oerrors.New(err, "failed to write cache", "gvk", gvkString, "context", context).
+							WithClass(oerrors.ClassCache)
+						metrics.Errors.WithLabelValues(context, gvkString, string(err.Class())).Inc()
+						logger.Errorw(err.Error(), "class", err.Class())
+					}
+					continue
+				}
+				if err != nil {
+					errorCount++
+					logger.Errorw(oerrors.New(err, "failed to get resource",
+						"gvk", gvkString, "context", context).Error())
+					continue
+				}
+				t, err := newTracker(logger, events, store, cluster, gvkString, gvkConfig)
+				if err != nil {
+					errorCount++
+					logger.Errorw(oerrors.New(err, "failed to create tracker",
+						"gvk", gvkString, "context", context).Error())
+					continue
+				}
+				t.servedVersion = gvr.Version
+				t.informer = factory.ForResource(gvr).Informer()
+				t.informer.AddEventHandler(t)
+				trackers = append(trackers, t)
+			}
+			factory.Start(c.Done())
+		}
+		if len(trackers) == 0 {
+			logger.Fatalf("nothing to watch (%d errors written to stderr)", errorCount)
+		}
+
+		var wg sync.WaitGroup
+		for _, t := range trackers {
+			wg.Add(1)
+			go func(t *tracker) {
+				defer wg.Done()
+				if !toolscache.WaitForCacheSync(c.Done(), t.informer.HasSynced) {
+					return
+				}
+				t.logger.Infow("synced")
+				t.pruneMissing()
+			}(t)
+		}
+
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				flush(trackers)
+			case <-c.Done():
+				wg.Wait()
+				flush(trackers)
+				return
+			}
+		}
+	},
+}
+
+func flush(trackers []*tracker) {
+	for _, t := range trackers {
+		if err := t.flush(); err != nil {
+			err := oerrors.New(err, "failed to write cache", "gvk", t.gvkString, "context", t.context).
+				WithClass(oerrors.ClassCache)
+			metrics.Errors.WithLabelValues(t.context, t.gvkString, string(err.Class())).Inc()
+			t.logger.Errorw(err.Error(), "class", err.Class())
+		}
+	}
+}
+
+// tracker keeps the sanitized objects of one (context, GVK) and mirrors them to the cache file.
+type tracker struct {
+	logger    *zap.SugaredLogger
+	events    *eventWriter
+	context   string
+	gvkString string
+	gvkConfig *config.GVK
+	labels    map[string]string
+	store     cache.Store
+	informer  toolscache.SharedIndexInformer
+	// servedVersion is the version being watched
+	servedVersion string
+
+	mu    sync.Mutex
+	objs  map[string]*unstructured.Unstructured
+	dirty bool
+}
+
+func newTracker(logger *zap.SugaredLogger, events *eventWriter, store cache.Store, cluster *config.Cluster,
+	gvkString string, gvkConfig *config.GVK) (*tracker, error) {
+	context := cluster.Name
+	// start from the existing cache so that unchanged objects don't produce events
+	cached, err := store.Get(context, gvkString)
+	if err != nil {
+		return nil, err
+	}
+	objs := make(map[string]*unstructured.Unstructured, len(cached))
+	for _, obj := range cached {
+		objs[util.ObjectKey(obj)] = obj
+	}
+	return &tracker{
+		logger:    logger,
+		events:    events,
+		context:   context,
+		gvkString: gvkString,
+		gvkConfig: gvkConfig,
+		labels:    cluster.Labels,
+		store:     store,
+		objs:      objs,
+		dirty:     cached == nil,
+	}, nil
+}
+
+func (t *tracker) OnAdd(obj interface{}) {
+	t.handle(obj)
+}
+
+func (t *tracker) OnUpdate(oldObj, newObj interface{}) {
+	t.handle(newObj)
+}
+
+func (t *tracker) OnDelete(obj interface{}) {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	uObj, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		t.logger.Warnf("unexpected object type %T", obj)
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.remove(util.ObjectKey(uObj))
+}
+
+func (t *tracker) handle(obj interface{}) {
+	uObj, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		t.logger.Warnf("unexpected object type %T", obj)
+		return
+	}
+	sanObj, err := util.Sanitize(t.logger.Named(util.ComponentSanitize), uObj, t.gvkConfig.IgnoreNames,
+		t.gvkConfig.PathValueFilters, t.gvkConfig.KeepAnnotations, t.gvkConfig.IgnoreAnnotations, t.gvkConfig.KeepLabels,
+		t.gvkConfig.IgnoreLabels, t.gvkConfig.KeepPaths, t.gvkConfig.IgnorePaths, t.gvkConfig.KeepDeleted)
+	if err != nil {
+		metrics.Errors.WithLabelValues(t.context, t.gvkString, string(oerrors.ClassSanitize)).Inc()
+		t.logger.Errorw(oerrors.New(err, "failed to sanitize",
+			"gvk", t.gvkString, "context", t.context, "name", uObj.GetName()).Error(), "class", oerrors.ClassSanitize)
+		return
+	}
+	key := util.ObjectKey(uObj)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if sanObj == nil {
+		// the object no longer passes the filters
+		t.remove(key)
+		return
+	}
+	existing, ok := t.objs[key]
+	if ok && reflect.DeepEqual(existing.Object, sanObj.Object) {
+		return
+	}
+	t.objs[key] = sanObj
+	t.dirty = true
+	eventType := eventAdd
+	if ok {
+		eventType = eventUpdate
+	}
+	t.emit(eventType, sanObj.GetNamespace(), sanObj.GetName(), sanObj)
+}
+
+// remove must be called with mu held.
+func (t *tracker) remove(key string) {
+	existing, ok := t.objs[key]
+	if !ok {
+		return
+	}
+	delete(t.objs, key)
+	t.dirty = true
+	t.emit(eventDelete, existing.GetNamespace(), existing.GetName(), nil)
+}
+
+func (t *tracker) emit(eventType, namespace, name string, obj *unstructured.Unstructured) {
+	metrics.WatchEvents.WithLabelValues(t.context, t.gvkString, eventType).Inc()
+	err := t.events.write(&event{
+		Type:      eventType,
+		Time:      time.Now(),
+		Cluster:   t.context,
+		GVK:       t.gvkString,
+		Namespace: namespace,
+		Name:      name,
+		Object:    obj,
+	})
+	if err != nil {
+		t.logger.Errorw(oerrors.New(err, "failed to write event",
+			"gvk", t.gvkString, "context", t.context).Error())
+	}
+}
+
+// pruneMissing removes cached objects that were deleted while we weren't watching. It must be called after the
+// informer has synced.
+func (t *tracker) pruneMissing() {
+	store := t.informer.GetStore()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key := range t.objs {
+		if _, exists, _ := store.GetByKey(key); !exists {
+			t.remove(key)
+		}
+	}
+}
+
+// flush writes the cache file if anything changed since the last flush. The file is replaced atomically so
+// readers never see a partial write.
+func (t *tracker) flush() error {
+	t.mu.Lock()
+	if !t.dirty {
+		t.mu.Unlock()
+		return nil
+	}
+	objs := make([]*unstructured.Unstructured, 0, len(t.objs))
+	for _, obj := range t.objs {
+		objs = append(objs, obj)
+	}
+	t.dirty = false
+	t.mu.Unlock()
+
+	sort.Slice(objs, func(i, j int) bool {
+		return util.ObjectKey(objs[i]) < util.ObjectKey(objs[j])
+	})
+	meta := &cache.Meta{ConfigHash: t.gvkConfig.Hash, Labels: t.labels, ServedVersion: t.servedVersion}
+	if err := t.store.Put(t.context, t.gvkString, objs, meta); err != nil {
+		t.mu.Lock()
+		t.dirty = true
+		t.mu.Unlock()
+		return err
+	}
+	t.logger.Named(util.ComponentCache).Infow("cached", "sanitizedObjCount", len(objs))
+	return nil
+}
+
+func init() {
+	Cmd.Flags().StringP("output", "o", "-", "file to append NDJSON events to (- for stdout)")
+	viper.BindPFlag("output", Cmd.Flags().Lookup("output"))
+	Cmd.Flags().Duration("flush-interval", 5*time.Second, "how often changed caches are written")
+	viper.BindPFlag("flush-interval", Cmd.Flags().Lookup("flush-interval"))
+	Cmd.Flags().String("metrics-addr", "", "address to serve Prometheus metrics on (disabled if empty)")
+	viper.BindPFlag("metrics-addr", Cmd.Flags().Lookup("metrics-addr"))
+}
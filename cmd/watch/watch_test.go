@@ -0,0 +1,213 @@
+package watch
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	"github.com/mlowery/mcfetcher/pkg/cache"
+	"github.com/mlowery/mcfetcher/pkg/config"
+)
+
+func newConfigMap(name, value string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"data": map[string]interface{}{"k": value},
+		// not kept so changes to it are no-ops
+		"status": map[string]interface{}{"v": value},
+	}}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetNamespace("ns")
+	obj.SetName(name)
+	return obj
+}
+
+func newTestTracker(t *testing.T, store cache.Store) (*tracker, *bytes.Buffer) {
+	var out bytes.Buffer
+	tr, err := newTracker(zap.NewNop().Sugar(), &eventWriter{enc: json.NewEncoder(&out)}, store,
+		&config.Cluster{Name: "c1"}, "configmap.", &config.GVK{KeepPaths: []string{"/data"}, Hash: "h"})
+	if err != nil {
+		t.Fatalf("newTracker() error = %v", err)
+	}
+	tr.informer = toolscache.NewSharedIndexInformer(nil, &unstructured.Unstructured{}, 0, toolscache.Indexers{})
+	return tr, &out
+}
+
+func readEvents(t *testing.T, out *bytes.Buffer) []string {
+	var got []string
+	dec := json.NewDecoder(out)
+	for dec.More() {
+		var e event
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("failed to decode event: %v", err)
+		}
+		got = append(got, e.Type+" "+e.Namespace+"/"+e.Name)
+	}
+	return got
+}
+
+func TestTracker_handle(t *testing.T) {
+	deleting := newConfigMap("a", "2")
+	now := metav1.Now()
+	deleting.SetDeletionTimestamp(&now)
+	notKept := newConfigMap("a", "1")
+	notKept.Object["status"] = map[string]interface{}{"v": "other"}
+	tests := []struct {
+		name string
+		// op is add, update, delete, or tombstone (a delete missed by the informer)
+		op         string
+		obj        *unstructured.Unstructured
+		wantEvents []string
+		wantDirty  bool
+	}{
+		{"add", "add", newConfigMap("a", "1"), []string{"add ns/a"}, true},
+		{"no-op update", "update", newConfigMap("a", "1"), nil, false},
+		{"update of a field that isn't kept", "update", notKept, nil, false},
+		{"update", "update", newConfigMap("a", "2"), []string{"update ns/a"}, true},
+		{"filtered out", "update", deleting, []string{"delete ns/a"}, true},
+		{"add again", "add", newConfigMap("a", "2"), []string{"add ns/a"}, true},
+		{"delete", "delete", newConfigMap("a", "2"), []string{"delete ns/a"}, true},
+		{"delete of unknown", "delete", newConfigMap("b", "1"), nil, false},
+		{"add b", "add", newConfigMap("b", "1"), []string{"add ns/b"}, true},
+		{"tombstone", "tombstone", newConfigMap("b", "1"), []string{"delete ns/b"}, true},
+	}
+	tr, out := newTestTracker(t, cache.NewMemStore())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr.dirty = false
+			switch tt.op {
+			case "add":
+				tr.OnAdd(tt.obj)
+			case "update":
+				tr.OnUpdate(nil, tt.obj)
+			case "delete":
+				tr.OnDelete(tt.obj)
+			case "tombstone":
+				tr.OnDelete(toolscache.DeletedFinalStateUnknown{Key: "ns/" + tt.obj.GetName(), Obj: tt.obj})
+			}
+			if got := readEvents(t, out); !reflect.DeepEqual(got, tt.wantEvents) {
+				t.Errorf("events = %v, want %v", got, tt.wantEvents)
+			}
+			if tr.dirty != tt.wantDirty {
+				t.Errorf("dirty = %v, want %v", tr.dirty, tt.wantDirty)
+			}
+		})
+	}
+}
+
+func TestTracker_pruneMissingAndFlush(t *testing.T) {
+	store := cache.NewMemStore()
+	store.Put("c1", "configmap.", []*unstructured.Unstructured{newConfigMap("a", "1"), newConfigMap("b", "1")}, nil)
+	tr, out := newTestTracker(t, store)
+	if tr.dirty {
+		t.Errorf("dirty = true for a tracker started from the cache")
+	}
+	// b was deleted while nothing was watching
+	if err := tr.informer.GetStore().Add(newConfigMap("a", "1")); err != nil {
+		t.Fatal(err)
+	}
+	tr.pruneMissing()
+	if got, want := readEvents(t, out), []string{"delete ns/b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	tr.handle(newConfigMap("c", "1"))
+	if err := tr.flush(); err != nil {
+		t.Fatalf("flush() error = %v", err)
+	}
+	stored, _ := store.Get("c1", "configmap.")
+	var names []string
+	for _, obj := range stored {
+		names = append(names, obj.GetName())
+	}
+	if want := []string{"a", "c"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("flushed %v, want %v", names, want)
+	}
+	if meta, _ := store.GetMeta("c1", "configmap."); meta == nil || meta.ConfigHash != "h" {
+		t.Errorf("flushed meta = %+v, want config hash h", meta)
+	}
+	if tr.dirty {
+		t.Errorf("dirty = true after flush")
+	}
+
+	// nothing changed so nothing is written
+	store.Remove("c1", "configmap.")
+	if err := tr.flush(); err != nil {
+		t.Fatalf("flush() error = %v", err)
+	}
+	if exists, _ := store.Exists("c1", "configmap."); exists {
+		t.Errorf("flush() wrote without changes")
+	}
+}
+
+func Test_newLoggerAndEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mcfetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderr.Close()
+	origStdout, origStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdout, stderr
+	logger, events, dFunc := newLoggerAndEvents("-")
+	os.Stdout, os.Stderr = origStdout, origStderr
+
+	logger.Infow("synced", "context", "c1")
+	if err := events.write(&event{Type: eventAdd, Cluster: "c1", GVK: "configmap.", Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	logger.Debugw("cached", "context", "c1")
+	logger.Warnw("retrying", "context", "c1")
+	if err := events.write(&event{Type: eventDelete, Cluster: "c1", GVK: "configmap.", Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	dFunc()
+
+	b, err := ioutil.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var e map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("stdout line %q is not JSON: %v", line, err)
+		}
+		if _, ok := e["msg"]; ok {
+			t.Errorf("stdout line %q is a log record, want only events", line)
+			continue
+		}
+		types = append(types, e["type"].(string))
+	}
+	if want := []string{eventAdd, eventDelete}; !reflect.DeepEqual(types, want) {
+		t.Errorf("events = %v, want %v", types, want)
+	}
+	b, err = ioutil.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{`"msg":"synced"`, `"msg":"retrying"`} {
+		if !strings.Contains(string(b), msg) {
+			t.Errorf("stderr = %q, want it to contain %s", b, msg)
+		}
+	}
+}
@@ -4,12 +4,17 @@ go 1.13
 
 require (
 	github.com/ghodss/yaml v1.0.0
+	github.com/klauspost/compress v1.10.10
+	github.com/mattn/go-sqlite3 v1.14.0
 	github.com/pkg/errors v0.8.1
+	github.com/prometheus/client_golang v1.5.1
+	github.com/prometheus/common v0.9.1
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.3.2
 	go.uber.org/zap v1.14.0
-	golang.org/x/sys v0.0.0-20191026070338-33540a1f6037 // indirect
+	golang.org/x/crypto v0.0.0-20200220183623-bac4c82f6975
+	golang.org/x/time v0.0.0-20190308202827-9d24e82272b4
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 	k8s.io/apimachinery v0.0.0-20200214081019-2373d029717c
 	k8s.io/cli-runtime v0.0.0-20200221172330-03707b9714f9
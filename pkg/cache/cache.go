@@ -0,0 +1,254 @@
+package cache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+const (
+	ext     = "json"
+	metaExt = "meta"
+)
+
+// Store holds sanitized objects per (context, GVK).
+type Store interface {
+	// Get returns nil (and no error) if nothing is stored for context and gvkString.
+	Get(context, gvkString string) ([]*unstructured.Unstructured, error)
+	// Put replaces what is stored for context and gvkString. meta may be nil; its Count and FetchedAt are filled in.
+	Put(context, gvkString string, objs []*unstructured.Unstructured, meta *Meta) error
+	// Exists returns true if something is stored for context and gvkString without reading it.
+	Exists(context, gvkString string) (bool, error)
+	// NewWriter returns a Writer that replaces what is stored for context and gvkString once committed.
+	NewWriter(context, gvkString string) (Writer, error)
+	// GetMeta returns nil (and no error) if there is no metadata for context and gvkString.
+	GetMeta(context, gvkString string) (*Meta, error)
+}
+
+// Writer stores objects one at a time so that a whole list never has to be held in memory. Nothing is visible to
+// Get until Commit is called. Either Commit or Abort must be called.
+type Writer interface {
+	Write(obj *unstructured.Unstructured) error
+	// Commit makes the written objects visible. meta may be nil; its Count and FetchedAt are filled in.
+	Commit(meta *Meta) error
+	Abort() error
+}
+
+// Meta describes what is stored for a (context, GVK). It is written next to the objects.
+type Meta struct {
+	// Count is the number of objects stored.
+	Count int `json:"count"`
+	// ConfigHash is config.GVK.Hash of the config the objects were sanitized with.
+	ConfigHash string    `json:"configHash,omitempty"`
+	FetchedAt  time.Time `json:"fetchedAt"`
+	// Labels are the labels of the cluster in the inventory.
+	Labels map[string]string `json:"labels,omitempty"`
+	// ServedVersion is the version the objects were listed in. It is empty for caches written before it was recorded.
+	ServedVersion string `json:"servedVersion,omitempty"`
+	// Absent means the cluster doesn't serve the GVK. No objects are stored.
+	Absent bool `json:"absent,omitempty"`
+}
+
+// Entry identifies one cache file.
+type Entry struct {
+	Context string
+	GVK     string
+	Path    string
+}
+
+// FileStore is a Store laid out as <dir>/<gvk>/<context>.json, with .gz or .zst appended if compressed.
+type FileStore struct {
+	dir string
+	// compression is used for writes. Files are read with whatever compression they were written with.
+	compression util.Compression
+}
+
+var _ Store = &FileStore{}
+
+func NewFileStore(dir string) *FileStore {
+	return NewCompressedFileStore(dir, util.CompressionNone)
+}
+
+// NewCompressedFileStore returns a FileStore that writes files compressed with compression.
+func NewCompressedFileStore(dir string, compression util.Compression) *FileStore {
+	return &FileStore{dir: dir, compression: compression}
+}
+
+// Dir returns the directory the store is rooted at.
+func (s *FileStore) Dir() string {
+	return s.dir
+}
+
+// Path returns the path of the cache file for context and gvkString. It is the existing file if there is one,
+// otherwise the file that would be written.
+func (s *FileStore) Path(context, gvkString string) (string, error) {
+	existing, err := s.existing(context, gvkString)
+	if err != nil {
+		return "", err
+	}
+	if len(existing) > 0 {
+		return existing[0], nil
+	}
+	return util.CacheFilename(s.dir, context, gvkString, ext+s.compression.Ext()), nil
+}
+
+// existing returns the cache files for context and gvkString in any compression. There is normally at most one.
+func (s *FileStore) existing(context, gvkString string) ([]string, error) {
+	var paths []string
+	for _, c := range util.Compressions {
+		filename := util.CacheFilename(s.dir, context, gvkString, ext+c.Ext())
+		_, err := os.Stat(filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to check for file existence")
+		}
+		paths = append(paths, filename)
+	}
+	return paths, nil
+}
+
+func (s *FileStore) Get(context, gvkString string) ([]*unstructured.Unstructured, error) {
+	existing, err := s.existing(context, gvkString)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) == 0 {
+		return nil, nil
+	}
+	objs, err := util.ReadRawObjects(existing[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read cached records (filename=%s)", existing[0])
+	}
+	return objs, nil
+}
+
+func (s *FileStore) Put(context, gvkString string, objs []*unstructured.Unstructured, meta *Meta) error {
+	w, err := s.NewWriter(context, gvkString)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		if err := w.Write(obj); err != nil {
+			w.Abort()
+			return err
+		}
+	}
+	return w.Commit(meta)
+}
+
+func (s *FileStore) Exists(context, gvkString string) (bool, error) {
+	existing, err := s.existing(context, gvkString)
+	if err != nil {
+		return false, err
+	}
+	return len(existing) > 0, nil
+}
+
+// NewWriter returns a Writer for the file in the store's compression. Files in other compressions are removed on
+// Commit so that switching compression doesn't leave stale copies behind.
+func (s *FileStore) NewWriter(context, gvkString string) (Writer, error) {
+	filename, err := util.MkCacheFilename(s.dir, context, gvkString, ext+s.compression.Ext())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to ensure cache dir")
+	}
+	existing, err := s.existing(context, gvkString)
+	if err != nil {
+		return nil, err
+	}
+	var stale []string
+	for _, p := range existing {
+		if p != filename {
+			stale = append(stale, p)
+		}
+	}
+	metaFilename, err := util.MkCacheFilename(s.dir, context, gvkString, metaExt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to ensure cache dir")
+	}
+	return newFileWriter(filename, metaFilename, s.compression, stale)
+}
+
+// GetMeta returns the metadata of context and gvkString or nil if there is none. Caches written before metadata was
+// recorded have none.
+func (s *FileStore) GetMeta(context, gvkString string) (*Meta, error) {
+	filename := util.CacheFilename(s.dir, context, gvkString, metaExt)
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read metadata (filename=%s)", filename)
+	}
+	meta := &Meta{}
+	if err := json.Unmarshal(b, meta); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal metadata (filename=%s)", filename)
+	}
+	return meta, nil
+}
+
+// Remove deletes everything stored for context and gvkString.
+func (s *FileStore) Remove(context, gvkString string) error {
+	existing, err := s.existing(context, gvkString)
+	if err != nil {
+		return err
+	}
+	metaFilename := util.CacheFilename(s.dir, context, gvkString, metaExt)
+	for _, p := range append(existing, metaFilename) {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to remove %q", p)
+		}
+	}
+	return nil
+}
+
+// List returns every cache file in the store. Snapshots are not included.
+func (s *FileStore) List() ([]*Entry, error) {
+	gvkInfos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read cache dir")
+	}
+	var entries []*Entry
+	for _, gvkInfo := range gvkInfos {
+		if !gvkInfo.IsDir() || gvkInfo.Name() == util.SnapshotsDir {
+			continue
+		}
+		d := filepath.Join(s.dir, gvkInfo.Name())
+		infos, err := ioutil.ReadDir(d)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read cache dir %q", d)
+		}
+		for _, info := range infos {
+			context, ok := trimCacheExt(info.Name())
+			if info.IsDir() || !ok {
+				continue
+			}
+			entries = append(entries, &Entry{
+				Context: context,
+				GVK:     gvkInfo.Name(),
+				Path:    filepath.Join(d, info.Name()),
+			})
+		}
+	}
+	return entries, nil
+}
+
+// trimCacheExt returns name without its cache file extension or false if name isn't a cache file.
+func trimCacheExt(name string) (string, bool) {
+	for _, c := range util.Compressions {
+		suffix := "." + ext + c.Ext()
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mcfetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("Namespace")
+	obj.SetName("a")
+	objs := []*unstructured.Unstructured{obj, obj}
+
+	if err := NewFileStore(dir).Put("c1", "namespace.", objs, &Meta{ConfigHash: "abc"}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	// rewriting with another compression replaces the file instead of adding a second one
+	s := NewCompressedFileStore(dir, util.CompressionZstd)
+	if err := s.Put("c1", "namespace.", objs, &Meta{ConfigHash: "def"}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	entries, err := s.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Context != "c1" || entries[0].GVK != "namespace." {
+		t.Fatalf("List() = %v, want one entry for c1 namespace.", entries)
+	}
+	got, err := NewFileStore(dir).Get("c1", "namespace.")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if len(got) != len(objs) {
+		t.Errorf("Get() got %d objects, want %d", len(got), len(objs))
+	}
+	meta, err := s.GetMeta("c1", "namespace.")
+	if err != nil {
+		t.Fatalf("GetMeta() error = %v", err)
+	}
+	if meta == nil || meta.Count != len(objs) || meta.ConfigHash != "def" || meta.FetchedAt.IsZero() {
+		t.Errorf("GetMeta() = %+v, want count %d and config hash def", meta, len(objs))
+	}
+
+	if err := s.Remove("c1", "namespace."); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if exists, err := s.Exists("c1", "namespace."); err != nil || exists {
+		t.Errorf("Exists() after Remove() = %v, %v, want false", exists, err)
+	}
+	if meta, err := s.GetMeta("c1", "namespace."); err != nil || meta != nil {
+		t.Errorf("GetMeta() after Remove() = %v, %v, want nil", meta, err)
+	}
+}
+
+func TestFileStore_ReadsCreateNothing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mcfetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := NewFileStore(dir)
+
+	if objs, err := s.Get("c1", "namespace."); err != nil || objs != nil {
+		t.Errorf("Get() = %v, %v, want nil, nil", objs, err)
+	}
+	if exists, err := s.Exists("c1", "namespace."); err != nil || exists {
+		t.Errorf("Exists() = %v, %v, want false, nil", exists, err)
+	}
+	if meta, err := s.GetMeta("c1", "namespace."); err != nil || meta != nil {
+		t.Errorf("GetMeta() = %v, %v, want nil, nil", meta, err)
+	}
+	if _, err := s.Path("c1", "namespace."); err != nil {
+		t.Errorf("Path() error = %v", err)
+	}
+	if err := s.Remove("c1", "namespace."); err != nil {
+		t.Errorf("Remove() error = %v", err)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) > 0 {
+		t.Errorf("store dir has %d entries after reads, want none", len(infos))
+	}
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// MemStore is a Store kept in memory for tests. It is safe for concurrent use.
+type MemStore struct {
+	mu   sync.Mutex
+	objs map[string][]*unstructured.Unstructured
+	meta map[string]*Meta
+}
+
+var _ Store = &MemStore{}
+
+func NewMemStore() *MemStore {
+	return &MemStore{objs: map[string][]*unstructured.Unstructured{}, meta: map[string]*Meta{}}
+}
+
+func memKey(context, gvkString string) string {
+	return context + "/" + gvkString
+}
+
+func (s *MemStore) Get(context, gvkString string) ([]*unstructured.Unstructured, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.objs[memKey(context, gvkString)], nil
+}
+
+func (s *MemStore) Put(context, gvkString string, objs []*unstructured.Unstructured, meta *Meta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(memKey(context, gvkString), objs, meta)
+	return nil
+}
+
+// put fills in meta like FileStore does. The caller must hold mu.
+func (s *MemStore) put(key string, objs []*unstructured.Unstructured, meta *Meta) {
+	m := Meta{}
+	if meta != nil {
+		m = *meta
+	}
+	m.Count = len(objs)
+	if m.FetchedAt.IsZero() {
+		m.FetchedAt = time.Now().UTC()
+	}
+	if objs == nil {
+		// Get returns nil for nothing stored, so an empty list is stored as empty
+		objs = []*unstructured.Unstructured{}
+	}
+	s.objs[key] = objs
+	s.meta[key] = &m
+}
+
+func (s *MemStore) Exists(context, gvkString string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.objs[memKey(context, gvkString)]
+	return ok, nil
+}
+
+func (s *MemStore) NewWriter(context, gvkString string) (Writer, error) {
+	return &memWriter{store: s, key: memKey(context, gvkString)}, nil
+}
+
+func (s *MemStore) GetMeta(context, gvkString string) (*Meta, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.meta[memKey(context, gvkString)], nil
+}
+
+// Remove removes what is stored for context and gvkString.
+func (s *MemStore) Remove(context, gvkString string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objs, memKey(context, gvkString))
+	delete(s.meta, memKey(context, gvkString))
+	return nil
+}
+
+type memWriter struct {
+	store *MemStore
+	key   string
+	objs  []*unstructured.Unstructured
+}
+
+func (w *memWriter) Write(obj *unstructured.Unstructured) error {
+	w.objs = append(w.objs, obj)
+	return nil
+}
+
+func (w *memWriter) Commit(meta *Meta) error {
+	w.store.mu.Lock()
+	defer w.store.mu.Unlock()
+	w.store.put(w.key, w.objs, meta)
+	return nil
+}
+
+func (w *memWriter) Abort() error {
+	return nil
+}
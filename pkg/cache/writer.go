@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+// fileWriter writes a JSON array one element at a time to a temporary file next to filename, then syncs it and renames
+// it over filename on Commit. The result reads back the same as a file written by util.WriteRawObjects.
+type fileWriter struct {
+	filename     string
+	metaFilename string
+	// stale files are removed on Commit
+	stale []string
+	file  *os.File
+	buf   *bufio.Writer
+	// w compresses into buf
+	w     io.WriteCloser
+	count int
+}
+
+func newFileWriter(filename, metaFilename string, compression util.Compression, stale []string) (*fileWriter, error) {
+	file, err := util.CreateTemp(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create file")
+	}
+	buf := bufio.NewWriter(file)
+	cw, err := util.NewCompressWriter(buf, compression)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, errors.Wrapf(err, "failed to create compressor")
+	}
+	w := &fileWriter{filename: filename, metaFilename: metaFilename, stale: stale, file: file, buf: buf, w: cw}
+	if _, err := io.WriteString(w.w, "["); err != nil {
+		w.Abort()
+		return nil, errors.Wrapf(err, "failed to write file")
+	}
+	return w, nil
+}
+
+func (w *fileWriter) Write(obj *unstructured.Unstructured) error {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal object")
+	}
+	if w.count > 0 {
+		if _, err := io.WriteString(w.w, ","); err != nil {
+			return errors.Wrapf(err, "failed to write file")
+		}
+	}
+	if _, err := w.w.Write(b); err != nil {
+		return errors.Wrapf(err, "failed to write file")
+	}
+	w.count++
+	return nil
+}
+
+func (w *fileWriter) Commit(meta *Meta) error {
+	if _, err := io.WriteString(w.w, "]"); err != nil {
+		w.Abort()
+		return errors.Wrapf(err, "failed to write file")
+	}
+	if err := w.w.Close(); err != nil {
+		w.Abort()
+		return errors.Wrapf(err, "failed to compress file")
+	}
+	if err := w.buf.Flush(); err != nil {
+		w.Abort()
+		return errors.Wrapf(err, "failed to write file")
+	}
+	if err := util.CommitTemp(w.file, w.filename, 0644); err != nil {
+		return err
+	}
+	for _, p := range w.stale {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to remove stale file (filename=%s)", p)
+		}
+	}
+	// the objects are already in place so a failure here only loses the metadata, which cache verify reports
+	m := Meta{}
+	if meta != nil {
+		m = *meta
+	}
+	m.Count = w.count
+	if m.FetchedAt.IsZero() {
+		m.FetchedAt = time.Now().UTC()
+	}
+	b, err := json.Marshal(&m)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal metadata")
+	}
+	if err := util.WriteFileAtomic(w.metaFilename, b, 0644); err != nil {
+		return errors.Wrapf(err, "failed to write metadata (filename=%s)", w.metaFilename)
+	}
+	return nil
+}
+
+func (w *fileWriter) Abort() error {
+	w.file.Close()
+	if err := os.Remove(w.file.Name()); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to remove file")
+	}
+	return nil
+}
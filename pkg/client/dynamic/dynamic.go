@@ -1,6 +1,8 @@
 package dynamic
 
 import (
+	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/pkg/errors"
@@ -8,19 +10,88 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/transport"
+
+	"github.com/mlowery/mcfetcher/pkg/config"
 )
 
 type Client struct {
 	restMapper meta.RESTMapper
-	client     dynamic.Interface
+	// preferredVersions are the preferred version of each group from discovery
+	preferredVersions map[string]string
+	client            dynamic.Interface
+	metadataClient    metadata.Interface
+}
+
+// ClientConfig returns the client config for context, loaded from kubeconfig (or the default loading rules if
+// kubeconfig is empty).
+func ClientConfig(context, kubeconfig string) clientcmd.ClientConfig {
+	pathOptions := clientcmd.NewDefaultPathOptions()
+	loadingRules := *pathOptions.LoadingRules
+	loadingRules.Precedence = pathOptions.GetLoadingPrecedence()
+	loadingRules.ExplicitPath = kubeconfig
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: context,
+	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(&loadingRules, overrides)
+}
+
+// ApplySettings sets s on c. It must be called before clients are built from c. s may be nil.
+func ApplySettings(c *restclient.Config, s *config.ClientSettings) error {
+	if s == nil {
+		return nil
+	}
+	if len(s.ImpersonateUser) > 0 {
+		c.Impersonate.UserName = s.ImpersonateUser
+	}
+	if len(s.ImpersonateGroups) > 0 {
+		c.Impersonate.Groups = s.ImpersonateGroups
+	}
+	if s.QPS > 0 {
+		c.QPS = s.QPS
+	}
+	if s.Burst > 0 {
+		c.Burst = s.Burst
+	}
+	if len(s.TLSServerName) > 0 {
+		c.TLSClientConfig.ServerName = s.TLSServerName
+	}
+	if len(s.Proxy) > 0 {
+		proxyURL, err := url.Parse(s.Proxy)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse proxy")
+		}
+		// innermost so that it sees the base transport rather than auth wrappers
+		c.WrapTransport = transport.Wrappers(proxyWrapper(proxyURL), c.WrapTransport)
+	}
+	return nil
+}
+
+// proxyWrapper sends requests through proxyURL. This version of rest.Config has no proxy setting so the base
+// transport is cloned with its Proxy replaced. The base transport is shared by every client with the same TLS config
+// and must not be modified in place.
+func proxyWrapper(proxyURL *url.URL) transport.WrapperFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		t, ok := rt.(*http.Transport)
+		if !ok {
+			// a custom transport from the kubeconfig; leave it alone
+			return rt
+		}
+		t = t.Clone()
+		t.Proxy = http.ProxyURL(proxyURL)
+		return t
+	}
 }
 
 func New(config *restclient.Config) (*Client, error) {
 	config.Timeout = 5 * time.Minute
-	restMapper, err := newDiscoveryRESTMapper(config)
+	restMapper, preferredVersions, err := newDiscoveryRESTMapper(config)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get discovery rest mapper")
 	}
@@ -28,27 +99,59 @@ func New(config *restclient.Config) (*Client, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get create dynamic client")
 	}
+	metadataClient, err := metadata.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get create metadata client")
+	}
 	return &Client{
-		restMapper: restMapper,
-		client:     dynamicClient,
+		restMapper:        restMapper,
+		preferredVersions: preferredVersions,
+		client:            dynamicClient,
+		metadataClient:    metadataClient,
 	}, nil
 }
 
-func newDiscoveryRESTMapper(c *rest.Config) (meta.RESTMapper, error) {
+// newDiscoveryRESTMapper returns a RESTMapper along with the preferred version of each group.
+func newDiscoveryRESTMapper(c *rest.Config) (meta.RESTMapper, map[string]string, error) {
 	// Get a mapper
 	dc, err := discovery.NewDiscoveryClientForConfig(c)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to create discovery client")
+		return nil, nil, errors.Wrapf(err, "failed to create discovery client")
 	}
 	gr, err := restmapper.GetAPIGroupResources(dc)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get api group resources")
+		return nil, nil, errors.Wrapf(err, "failed to get api group resources")
+	}
+	preferredVersions := map[string]string{}
+	for _, g := range gr {
+		preferredVersions[g.Group.Name] = g.Group.PreferredVersion.Version
+	}
+	return restmapper.NewDiscoveryRESTMapper(gr), preferredVersions, nil
+}
+
+// restMapping returns the mapping for gvk. If gvk has no version, the first of versions that is served is used or,
+// if versions is empty, the group's preferred version. That way the version doesn't depend on the order discovery
+// happens to return versions in.
+func (c *Client) restMapping(gvk schema.GroupVersionKind, versions []string) (*meta.RESTMapping, error) {
+	switch {
+	case len(gvk.Version) > 0:
+		versions = []string{gvk.Version}
+	case len(versions) == 0:
+		if preferred := c.preferredVersions[gvk.Group]; len(preferred) > 0 {
+			mapping, err := c.restMapper.RESTMapping(gvk.GroupKind(), preferred)
+			if !meta.IsNoMatchError(err) {
+				return mapping, err
+			}
+			// the kind isn't served in the preferred version; fall back to any version that serves it
+		}
 	}
-	return restmapper.NewDiscoveryRESTMapper(gr), nil
+	return c.restMapper.RESTMapping(gvk.GroupKind(), versions...)
 }
 
-func (c *Client) GetResourceInterface(gvk schema.GroupVersionKind, ns string) (dynamic.ResourceInterface, error) {
-	mapping, err := c.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+// GetResourceInterface returns the interface for gvk in namespace ns. See restMapping for versions.
+func (c *Client) GetResourceInterface(gvk schema.GroupVersionKind, versions []string, ns string) (
+	dynamic.ResourceInterface, error) {
+	mapping, err := c.restMapping(gvk, versions)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get rest mapping")
 	}
@@ -57,3 +160,31 @@ func (c *Client) GetResourceInterface(gvk schema.GroupVersionKind, ns string) (d
 	}
 	return c.client.Resource(mapping.Resource).Namespace(ns), nil
 }
+
+// GetMetadataResourceInterface is like GetResourceInterface but only object metadata is returned by the server. The
+// returned objects have no type information so the GVK that serves gvk is returned too.
+func (c *Client) GetMetadataResourceInterface(gvk schema.GroupVersionKind, versions []string, ns string) (
+	metadata.ResourceInterface, schema.GroupVersionKind, error) {
+	mapping, err := c.restMapping(gvk, versions)
+	if err != nil {
+		return nil, schema.GroupVersionKind{}, errors.Wrapf(err, "failed to get rest mapping")
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return c.metadataClient.Resource(mapping.Resource), mapping.GroupVersionKind, nil
+	}
+	return c.metadataClient.Resource(mapping.Resource).Namespace(ns), mapping.GroupVersionKind, nil
+}
+
+// Resource returns the resource that serves gvk. See restMapping for versions.
+func (c *Client) Resource(gvk schema.GroupVersionKind, versions []string) (schema.GroupVersionResource, error) {
+	mapping, err := c.restMapping(gvk, versions)
+	if err != nil {
+		return schema.GroupVersionResource{}, errors.Wrapf(err, "failed to get rest mapping")
+	}
+	return mapping.Resource, nil
+}
+
+// NewInformerFactory returns a factory for informers that watch all namespaces.
+func (c *Client) NewInformerFactory(resync time.Duration) dynamicinformer.DynamicSharedInformerFactory {
+	return dynamicinformer.NewDynamicSharedInformerFactory(c.client, resync)
+}
@@ -0,0 +1,93 @@
+package dynamic
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	restclient "k8s.io/client-go/rest"
+
+	"github.com/mlowery/mcfetcher/pkg/config"
+)
+
+func TestApplySettings(t *testing.T) {
+	c := &restclient.Config{}
+	err := ApplySettings(c, &config.ClientSettings{
+		ImpersonateUser:   "alice",
+		ImpersonateGroups: []string{"admins"},
+		QPS:               50,
+		Burst:             100,
+		TLSServerName:     "api.internal",
+		Proxy:             "http://proxy:3128",
+	})
+	if err != nil {
+		t.Fatalf("ApplySettings() error = %v", err)
+	}
+	if c.Impersonate.UserName != "alice" || len(c.Impersonate.Groups) != 1 || c.QPS != 50 || c.Burst != 100 ||
+		c.TLSClientConfig.ServerName != "api.internal" {
+		t.Errorf("ApplySettings() config = %+v", c)
+	}
+
+	base := &http.Transport{}
+	rt, ok := c.WrapTransport(base).(*http.Transport)
+	if !ok {
+		t.Fatalf("WrapTransport() returned %T, want *http.Transport", rt)
+	}
+	if base.Proxy != nil {
+		t.Errorf("WrapTransport() modified the base transport")
+	}
+	req := &http.Request{URL: &url.URL{Scheme: "https", Host: "api.internal"}}
+	proxyURL, err := rt.Proxy(req)
+	if err != nil || proxyURL.String() != "http://proxy:3128" {
+		t.Errorf("WrapTransport() proxy = %v, %v, want http://proxy:3128", proxyURL, err)
+	}
+}
+
+func TestClient_restMapping(t *testing.T) {
+	v1beta1 := schema.GroupVersion{Group: "apps", Version: "v1beta1"}
+	v1 := schema.GroupVersion{Group: "apps", Version: "v1"}
+	// v1beta1 first, like discovery returning versions in an unhelpful order
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{v1beta1, v1})
+	mapper.Add(v1beta1.WithKind("Deployment"), meta.RESTScopeNamespace)
+	mapper.Add(v1.WithKind("Deployment"), meta.RESTScopeNamespace)
+	mapper.Add(v1beta1.WithKind("Legacy"), meta.RESTScopeNamespace)
+
+	tests := []struct {
+		name      string
+		preferred string
+		gvk       schema.GroupVersionKind
+		versions  []string
+		want      string
+		wantErr   bool
+	}{
+		{name: "preferred", preferred: "v1", gvk: schema.GroupVersionKind{Group: "apps", Kind: "Deployment"},
+			want: "v1"},
+		{name: "versions", preferred: "v1", gvk: schema.GroupVersionKind{Group: "apps", Kind: "Deployment"},
+			versions: []string{"v1beta2", "v1beta1"}, want: "v1beta1"},
+		{name: "explicit version", preferred: "v1", gvk: v1beta1.WithKind("Deployment"), want: "v1beta1"},
+		{name: "not in preferred", preferred: "v1", gvk: schema.GroupVersionKind{Group: "apps", Kind: "Legacy"},
+			want: "v1beta1"},
+		{name: "none of versions", gvk: schema.GroupVersionKind{Group: "apps", Kind: "Deployment"},
+			versions: []string{"v2"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{restMapper: mapper, preferredVersions: map[string]string{"apps": tt.preferred}}
+			mapping, err := c.restMapping(tt.gvk, tt.versions)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("restMapping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !meta.IsNoMatchError(err) {
+					t.Errorf("restMapping() error = %v, want a no match error", err)
+				}
+				return
+			}
+			if got := mapping.GroupVersionKind.Version; got != tt.want {
+				t.Errorf("restMapping() version = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,13 +1,17 @@
 package config
 
 import (
-	"fmt"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"regexp"
 	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/mlowery/mcfetcher/pkg/util"
 )
 
 var (
@@ -15,6 +19,9 @@ var (
 )
 
 type rawGVK struct {
+	// Preset is the name of a built-in config whose fields are used where this one doesn't set them. It is left out of
+	// the hash since the fields it fills in are hashed.
+	Preset           string   `mapstructure:"preset" json:"-"`
 	KeepLabels       []string `mapstructure:"keep-labels"`
 	KeepAnnotations  []string `mapstructure:"keep-annotations"`
 	KeepPaths        []string `mapstructure:"keep-paths"`
@@ -22,9 +29,20 @@ type rawGVK struct {
 	IgnoreNames      []string `mapstructure:"ignore-names"`
 	PathValueFilters []string `mapstructure:"path-value-filters"`
 	KeepDeleted      bool     `mapstructure:"keep-deleted"`
+	// left out of the hash since it only changes how table displays what is cached
+	Columns      []string `mapstructure:"columns" json:"-"`
+	MetadataOnly *bool    `mapstructure:"metadata-only"`
+	// omitted when empty so that configs without them keep their hash
+	Versions          []string `mapstructure:"versions" json:",omitempty"`
+	IgnoreLabels      []string `mapstructure:"ignore-labels" json:",omitempty"`
+	IgnoreAnnotations []string `mapstructure:"ignore-annotations" json:",omitempty"`
+	// left out of the hash since it doesn't change what is cached
+	Required bool `mapstructure:"required" json:"-"`
 }
 
 type GVK struct {
+	// Name is the key of this config (e.g. namespace.).
+	Name             string
 	KeepLabels       []*regexp.Regexp
 	KeepAnnotations  []*regexp.Regexp
 	KeepPaths        []string
@@ -32,12 +50,57 @@ type GVK struct {
 	IgnoreNames      []*regexp.Regexp
 	PathValueFilters map[string]*regexp.Regexp
 	KeepDeleted      bool
+	Columns          []Column
+	// MetadataOnly lists only object metadata from live clusters. It defaults to true when every keep path and path
+	// value filter is under /metadata.
+	MetadataOnly     bool
 	GroupVersionKind schema.GroupVersionKind
+	// Versions are the versions to list in priority order when GroupVersionKind has no version. The first one a
+	// cluster serves is used. If empty, the group's preferred version is used.
+	Versions []string
+	// Hash identifies the raw config so that caches written with a different config can be detected.
+	Hash string
+	// Required makes it an error for a cluster not to serve the GVK. Otherwise the GVK is recorded as absent.
+	Required bool
+
+	// IgnoreLabels and IgnoreAnnotations drop keys matched by KeepLabels and KeepAnnotations.
+	IgnoreLabels      []*regexp.Regexp
+	IgnoreAnnotations []*regexp.Regexp
+}
+
+// Column is one column of tabular output, like kubectl custom-columns.
+type Column struct {
+	Name string
+	Path string
+}
+
+// Matches returns true if gvk is selected by this config. Kinds are compared case-insensitively and an empty
+// version matches any version (or any of Versions if set).
+func (g *GVK) Matches(gvk schema.GroupVersionKind) bool {
+	if g.GroupVersionKind.Group != gvk.Group {
+		return false
+	}
+	if len(g.GroupVersionKind.Version) > 0 && g.GroupVersionKind.Version != gvk.Version {
+		return false
+	}
+	if len(g.Versions) > 0 && !containsString(g.Versions, gvk.Version) {
+		return false
+	}
+	return strings.EqualFold(g.GroupVersionKind.Kind, gvk.Kind)
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
 }
 
 func keyOrDie(key string) {
 	if !viper.IsSet(key) {
-		panic(fmt.Sprintf("%q is required", key))
+		panic(util.ConfigErrorf("%q is required", key))
 	}
 }
 
@@ -49,6 +112,14 @@ func ReadString(key, def string) string {
 	return def
 }
 
+func ReadBool(key string) bool {
+	return viper.GetBool(key)
+}
+
+func ReadInt(key string) int {
+	return viper.GetInt(key)
+}
+
 func ReadStringSliceOrDie(key string) []string {
 	keyOrDie(key)
 	return viper.GetStringSlice(key)
@@ -59,14 +130,19 @@ func ReadGVKOrDie() map[string]*GVK {
 	rawGVKConfigs := map[string]*rawGVK{}
 	err := viper.UnmarshalKey(key, &rawGVKConfigs)
 	if err != nil {
-		panic(errors.Wrapf(err, "failed to unmarshal rawGVK"))
+		panic(util.NewConfigError(errors.Wrapf(err, "failed to unmarshal rawGVK")))
 	}
 	if len(rawGVKConfigs) == 0 {
-		panic(fmt.Sprintf("%q is required", key))
+		panic(util.ConfigErrorf("%q is required", key))
 	}
+	// the keys each config sets, since lists set to [] unmarshal the same as unset lists
+	setKeys := viper.GetStringMap(key)
 	gvkConfigs := map[string]*GVK{}
 	for k, v := range rawGVKConfigs {
+		set, _ := setKeys[k].(map[string]interface{})
+		v = applyPresetOrDie(k, v, set)
 		gvkConfig := &GVK{
+			Name:             k,
 			KeepAnnotations:  readRawRegexesOrDie(v.KeepAnnotations),
 			KeepLabels:       readRawRegexesOrDie(v.KeepLabels),
 			IgnoreNames:      readRawRegexesOrDie(v.IgnoreNames),
@@ -74,14 +150,31 @@ func ReadGVKOrDie() map[string]*GVK {
 			IgnorePaths:      v.IgnorePaths,
 			PathValueFilters: readPathValueFiltersOrDie(v.PathValueFilters),
 			KeepDeleted:      v.KeepDeleted,
+			Columns:          readColumnsOrDie(v.Columns),
+			Required:         v.Required,
 		}
+		gvkConfig.IgnoreAnnotations = readRawRegexesOrDie(v.IgnoreAnnotations)
+		gvkConfig.IgnoreLabels = readRawRegexesOrDie(v.IgnoreLabels)
+		gvkConfig.MetadataOnly = readMetadataOnlyOrDie(k, v.MetadataOnly, gvkConfig)
+		gvkConfig.Hash = hashOrDie(v)
 		group, version, kind := parseGVKString(k)
-		gvkConfig.GroupVersionKind = schema.GroupVersionKind{group, version, kind}
+		gvkConfig.GroupVersionKind = schema.GroupVersionKind{Group: group, Version: version, Kind: kind}
+		gvkConfig.Versions = readVersionsOrDie(k, v.Versions, version)
 		gvkConfigs[k] = gvkConfig
 	}
 	return gvkConfigs
 }
 
+// hashOrDie returns a short hash of raw. Field order is fixed by the struct so equal configs hash the same.
+func hashOrDie(raw *rawGVK) string {
+	b, err := json.Marshal(raw)
+	if err != nil {
+		panic(errors.Wrapf(err, "failed to marshal rawGVK"))
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
 func parseGVKString(gvkString string) (string, string, string) {
 	// kind.version.group
 	tokens := strings.SplitN(gvkString, ".", 2)
@@ -100,22 +193,86 @@ func parseGVKString(gvkString string) (string, string, string) {
 	return tokens[1], "", tokens[0]
 }
 
+// readMetadataOnlyOrDie returns raw if set, otherwise whether gvkConfig can be satisfied from metadata alone.
+func readMetadataOnlyOrDie(key string, raw *bool, gvkConfig *GVK) bool {
+	paths := append([]string{}, gvkConfig.KeepPaths...)
+	for path := range gvkConfig.PathValueFilters {
+		paths = append(paths, path)
+	}
+	var nonMetadataPath string
+	for _, path := range paths {
+		if !isMetadataPath(path) {
+			nonMetadataPath = path
+			break
+		}
+	}
+	if raw == nil {
+		return len(nonMetadataPath) == 0
+	}
+	if *raw && len(nonMetadataPath) > 0 {
+		panic(util.ConfigErrorf("metadata-only is set for %q but %q is not under /metadata", key,
+			nonMetadataPath))
+	}
+	return *raw
+}
+
+// readVersionsOrDie validates the versions list of key. It can only be set when key has no version.
+func readVersionsOrDie(key string, raw []string, version string) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	if len(version) > 0 {
+		panic(util.ConfigErrorf("versions is set for %q but its key already has version %q", key, version))
+	}
+	for _, v := range raw {
+		if !versionRegexp.MatchString(v) {
+			panic(util.ConfigErrorf("%q in versions of %q doesn't look like a version", v, key))
+		}
+	}
+	return raw
+}
+
+func isMetadataPath(path string) bool {
+	path = strings.TrimPrefix(path, "/")
+	return path == "metadata" || strings.HasPrefix(path, "metadata/")
+}
+
 func readPathValueFiltersOrDie(raw []string) map[string]*regexp.Regexp {
 	m := make(map[string]*regexp.Regexp)
 	for _, rawPathValueFilter := range raw {
 		tokens := strings.Split(rawPathValueFilter, "=")
 		if len(tokens) != 2 {
-			panic(fmt.Sprintf("unexpected number of tokens in %q", rawPathValueFilter))
+			panic(util.ConfigErrorf("unexpected number of tokens in %q", rawPathValueFilter))
 		}
-		m[tokens[0]] = regexp.MustCompile(tokens[1])
+		m[tokens[0]] = compileOrDie(tokens[1])
 	}
 	return m
 }
 
+func readColumnsOrDie(raw []string) []Column {
+	var columns []Column
+	for _, rawColumn := range raw {
+		tokens := strings.SplitN(rawColumn, "=", 2)
+		if len(tokens) != 2 || len(tokens[0]) == 0 || len(tokens[1]) == 0 {
+			panic(util.ConfigErrorf("expected NAME=/path in %q", rawColumn))
+		}
+		columns = append(columns, Column{Name: tokens[0], Path: tokens[1]})
+	}
+	return columns
+}
+
 func readRawRegexesOrDie(rawRegexes []string) []*regexp.Regexp {
 	var regexes []*regexp.Regexp
 	for _, rawRegexes := range rawRegexes {
-		regexes = append(regexes, regexp.MustCompile(rawRegexes))
+		regexes = append(regexes, compileOrDie(rawRegexes))
 	}
 	return regexes
 }
+
+func compileOrDie(raw string) *regexp.Regexp {
+	re, err := regexp.Compile(raw)
+	if err != nil {
+		panic(util.NewConfigError(err))
+	}
+	return re
+}
@@ -1,6 +1,11 @@
 package config
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
 
 func Test_parseGVKString(t *testing.T) {
 	type args struct {
@@ -57,3 +62,194 @@ func Test_parseGVKString(t *testing.T) {
 		})
 	}
 }
+
+func Test_readColumnsOrDie(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       []string
+		want      []Column
+		wantPanic bool
+	}{
+		{
+			"none",
+			nil,
+			nil,
+			false,
+		},
+		{
+			"ordered",
+			[]string{"NAME=/metadata/name", "IMAGE=/spec/template/spec/containers/0/image"},
+			[]Column{{"NAME", "/metadata/name"}, {"IMAGE", "/spec/template/spec/containers/0/image"}},
+			false,
+		},
+		{
+			"missing path",
+			[]string{"NAME="},
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); (r != nil) != tt.wantPanic {
+					t.Errorf("readColumnsOrDie() panic = %v, wantPanic %v", r, tt.wantPanic)
+				}
+			}()
+			if got := readColumnsOrDie(tt.raw); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readColumnsOrDie() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_readMetadataOnlyOrDie(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name      string
+		raw       *bool
+		keepPaths []string
+		filters   []string
+		want      bool
+		wantPanic bool
+	}{
+		{
+			"labels only",
+			nil,
+			nil,
+			nil,
+			true,
+			false,
+		},
+		{
+			"metadata paths",
+			nil,
+			[]string{"/metadata/ownerReferences"},
+			[]string{"/metadata/name=^a"},
+			true,
+			false,
+		},
+		{
+			"spec",
+			nil,
+			[]string{"/spec"},
+			nil,
+			false,
+			false,
+		},
+		{
+			"status filter",
+			nil,
+			nil,
+			[]string{"/status/phase=^Active$"},
+			false,
+			false,
+		},
+		{
+			"disabled",
+			&no,
+			nil,
+			nil,
+			false,
+			false,
+		},
+		{
+			"forced with spec",
+			&yes,
+			[]string{"/spec"},
+			nil,
+			false,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); (r != nil) != tt.wantPanic {
+					t.Errorf("readMetadataOnlyOrDie() panic = %v, wantPanic %v", r, tt.wantPanic)
+				}
+			}()
+			gvkConfig := &GVK{KeepPaths: tt.keepPaths, PathValueFilters: readPathValueFiltersOrDie(tt.filters)}
+			if got := readMetadataOnlyOrDie("pod.", tt.raw, gvkConfig); got != tt.want {
+				t.Errorf("readMetadataOnlyOrDie() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_readVersionsOrDie(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       []string
+		version   string
+		want      []string
+		wantPanic bool
+	}{
+		{
+			"unset",
+			nil,
+			"",
+			nil,
+			false,
+		},
+		{
+			"priority list",
+			[]string{"v1", "v1beta1"},
+			"",
+			[]string{"v1", "v1beta1"},
+			false,
+		},
+		{
+			"key has version",
+			[]string{"v1"},
+			"v1beta1",
+			nil,
+			true,
+		},
+		{
+			"not a version",
+			[]string{"latest"},
+			"",
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); (r != nil) != tt.wantPanic {
+					t.Errorf("readVersionsOrDie() panic = %v, wantPanic %v", r, tt.wantPanic)
+				}
+			}()
+			if got := readVersionsOrDie("deployment.apps", tt.raw, tt.version); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readVersionsOrDie() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadGVKOrDie_Hash(t *testing.T) {
+	defer viper.Reset()
+	const base = `
+[gvk."configmap."]
+    keep-paths = ["/data"]
+`
+	hash := readGVKFromTOML(t, base)["configmap."].Hash
+	tests := []struct {
+		name     string
+		extra    string
+		wantSame bool
+	}{
+		{name: "columns", extra: `    columns = ["NAME=/metadata/name"]`, wantSame: true},
+		{name: "required", extra: `    required = true`, wantSame: true},
+		{name: "ignore-paths", extra: `    ignore-paths = ["/data/x"]`, wantSame: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readGVKFromTOML(t, base+tt.extra+"\n")["configmap."].Hash
+			if (got == hash) != tt.wantSame {
+				t.Errorf("Hash = %s with %s, base hash %s, want same %v", got, tt.name, hash, tt.wantSame)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+type rawCluster struct {
+	Alias      string            `mapstructure:"alias"`
+	Context    string            `mapstructure:"context"`
+	Kubeconfig string            `mapstructure:"kubeconfig"`
+	Labels     map[string]string `mapstructure:"labels"`
+	Client     *ClientSettings   `mapstructure:"client"`
+}
+
+// ClientSettings adjust the rest config of a cluster before clients are built. Zero values leave the kubeconfig's
+// settings alone.
+type ClientSettings struct {
+	ImpersonateUser   string   `mapstructure:"as"`
+	ImpersonateGroups []string `mapstructure:"as-groups"`
+	QPS               float32  `mapstructure:"qps"`
+	Burst             int      `mapstructure:"burst"`
+	TLSServerName     string   `mapstructure:"tls-server-name"`
+	// Proxy is the URL of an HTTP(S) proxy. It overrides the environment (HTTPS_PROXY and friends).
+	Proxy string `mapstructure:"proxy"`
+	// RateLimitQPS limits requests to the cluster. Unlike QPS, which client-go applies to each client separately,
+	// one limiter is shared by discovery and lists.
+	RateLimitQPS   float64 `mapstructure:"rate-limit-qps"`
+	RateLimitBurst int     `mapstructure:"rate-limit-burst"`
+}
+
+// Merge returns s with every field that is set in override replaced. Either may be nil.
+func (s *ClientSettings) Merge(override *ClientSettings) *ClientSettings {
+	merged := &ClientSettings{}
+	if s != nil {
+		*merged = *s
+	}
+	if override == nil {
+		return merged
+	}
+	if len(override.ImpersonateUser) > 0 {
+		merged.ImpersonateUser = override.ImpersonateUser
+	}
+	if len(override.ImpersonateGroups) > 0 {
+		merged.ImpersonateGroups = override.ImpersonateGroups
+	}
+	if override.QPS > 0 {
+		merged.QPS = override.QPS
+	}
+	if override.Burst > 0 {
+		merged.Burst = override.Burst
+	}
+	if len(override.TLSServerName) > 0 {
+		merged.TLSServerName = override.TLSServerName
+	}
+	if len(override.Proxy) > 0 {
+		merged.Proxy = override.Proxy
+	}
+	if override.RateLimitQPS > 0 {
+		merged.RateLimitQPS = override.RateLimitQPS
+	}
+	if override.RateLimitBurst > 0 {
+		merged.RateLimitBurst = override.RateLimitBurst
+	}
+	return merged
+}
+
+// ReadClientSettingsOrDie returns the client settings that apply to every cluster, from the client section of the
+// config or the equivalent flags.
+func ReadClientSettingsOrDie() *ClientSettings {
+	s := &ClientSettings{
+		ImpersonateUser:   viper.GetString("client.as"),
+		ImpersonateGroups: viper.GetStringSlice("client.as-groups"),
+		QPS:               float32(viper.GetFloat64("client.qps")),
+		Burst:             viper.GetInt("client.burst"),
+		TLSServerName:     viper.GetString("client.tls-server-name"),
+		Proxy:             viper.GetString("client.proxy"),
+		RateLimitQPS:      viper.GetFloat64("client.rate-limit-qps"),
+		RateLimitBurst:    viper.GetInt("client.rate-limit-burst"),
+	}
+	if err := s.validate(); err != nil {
+		panic(util.NewConfigError(errors.Wrapf(err, "invalid client settings")))
+	}
+	return s
+}
+
+func (s *ClientSettings) validate() error {
+	if s.QPS < 0 || s.Burst < 0 || s.RateLimitQPS < 0 || s.RateLimitBurst < 0 {
+		return errors.Errorf("qps and burst must not be negative")
+	}
+	if len(s.Proxy) > 0 {
+		u, err := url.Parse(s.Proxy)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse proxy")
+		}
+		if len(u.Scheme) == 0 || len(u.Host) == 0 {
+			return errors.Errorf("expected a URL like http://host:port in proxy %q", s.Proxy)
+		}
+	}
+	return nil
+}
+
+// Cluster is one cluster to work on, from the inventory or from kubeconfig-contexts.
+type Cluster struct {
+	// Name identifies the cluster in cache paths and output. It is the alias if set, otherwise the context.
+	Name    string
+	Context string
+	// Kubeconfig is empty to use the global kubeconfig.
+	Kubeconfig string
+	Labels     map[string]string
+	// Client are the global client settings merged with the cluster's own. It is never nil.
+	Client *ClientSettings
+}
+
+// ReadClustersOrDie returns the clusters to work on. With an inventory, they are the inventory clusters matching
+// cluster-selector and, if set, named in kubeconfig-contexts, sorted by name. Without one, they are the contexts in
+// kubeconfig-contexts.
+func ReadClustersOrDie() []*Cluster {
+	inventory := viper.GetString("inventory")
+	selector, err := labels.Parse(viper.GetString("cluster-selector"))
+	if err != nil {
+		panic(util.NewConfigError(errors.Wrapf(err, "failed to parse cluster-selector")))
+	}
+	clientSettings := ReadClientSettingsOrDie()
+	if len(inventory) == 0 {
+		if !selector.Empty() {
+			panic(util.ConfigErrorf("cluster-selector requires an inventory"))
+		}
+		var clusters []*Cluster
+		for _, context := range ReadStringSliceOrDie("kubeconfig-contexts") {
+			clusters = append(clusters, &Cluster{Name: context, Context: context, Client: clientSettings})
+		}
+		return clusters
+	}
+
+	all, err := readInventory(inventory, clientSettings)
+	if err != nil {
+		panic(util.NewConfigError(errors.Wrapf(err, "failed to read inventory %q", inventory)))
+	}
+	names := map[string]bool{}
+	for _, name := range viper.GetStringSlice("kubeconfig-contexts") {
+		names[name] = true
+	}
+	var clusters []*Cluster
+	for _, c := range all {
+		if !selector.Matches(labels.Set(c.Labels)) || (len(names) > 0 && !names[c.Name]) {
+			continue
+		}
+		clusters = append(clusters, c)
+	}
+	if len(clusters) == 0 {
+		panic(util.ConfigErrorf("no clusters in inventory %q are selected", inventory))
+	}
+	return clusters
+}
+
+// ClusterNames returns the names of clusters.
+func ClusterNames(clusters []*Cluster) []string {
+	var names []string
+	for _, c := range clusters {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// readInventory reads a TOML or YAML file (by extension) with a clusters list. Relative kubeconfig paths are relative
+// to the inventory file. The client settings of each cluster override clientSettings.
+func readInventory(path string, clientSettings *ClientSettings) ([]*Cluster, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	var rawClusters []*rawCluster
+	if err := v.UnmarshalKey("clusters", &rawClusters); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal clusters")
+	}
+	var clusters []*Cluster
+	seen := map[string]bool{}
+	for i, rc := range rawClusters {
+		if len(rc.Context) == 0 {
+			return nil, errors.Errorf("context is required (cluster %d)", i)
+		}
+		c := &Cluster{
+			Name:    rc.Alias,
+			Context: rc.Context,
+			Labels:  rc.Labels,
+			Client:  clientSettings.Merge(rc.Client),
+		}
+		if err := c.Client.validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid client settings (cluster %d)", i)
+		}
+		if len(c.Name) == 0 {
+			c.Name = rc.Context
+		}
+		if seen[c.Name] {
+			return nil, errors.Errorf("duplicate cluster %q (set an alias to tell them apart)", c.Name)
+		}
+		seen[c.Name] = true
+		kubeconfig, err := resolvePath(filepath.Dir(path), rc.Kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		c.Kubeconfig = kubeconfig
+		clusters = append(clusters, c)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Name < clusters[j].Name
+	})
+	return clusters, nil
+}
+
+// resolvePath expands a leading ~/ and makes relative paths relative to dir.
+func resolvePath(dir, path string) (string, error) {
+	if len(path) == 0 || filepath.IsAbs(path) {
+		return path, nil
+	}
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to get home dir")
+		}
+		return filepath.Join(home, path[2:]), nil
+	}
+	return filepath.Join(dir, path), nil
+}
+
+// ClustersByName returns clusters keyed by name.
+func ClustersByName(clusters []*Cluster) map[string]*Cluster {
+	m := make(map[string]*Cluster, len(clusters))
+	for _, c := range clusters {
+		m[c.Name] = c
+	}
+	return m
+}
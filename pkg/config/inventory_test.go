@@ -0,0 +1,85 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestReadClustersOrDie(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mcfetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	inventory := filepath.Join(dir, "inventory.yaml")
+	err = ioutil.WriteFile(inventory, []byte(`
+clusters:
+- context: admin@prod-eu-1
+  alias: prod-eu-1
+  kubeconfig: kubeconfigs/prod-eu-1
+  labels: {env: prod, region: eu}
+  client:
+    qps: 50
+    proxy: http://proxy.eu:3128
+- context: admin@prod-us-1
+  alias: prod-us-1
+  kubeconfig: /etc/kubeconfigs/prod-us-1
+  labels: {env: prod, region: us}
+- context: dev
+  labels: {env: dev, region: eu}
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer viper.Reset()
+
+	tests := []struct {
+		name     string
+		selector string
+		contexts []string
+		want     []string
+	}{
+		{"all", "", nil, []string{"dev", "prod-eu-1", "prod-us-1"}},
+		{"selector", "env=prod,region=eu", nil, []string{"prod-eu-1"}},
+		{"set selector", "region in (eu)", []string{"dev"}, []string{"dev"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			viper.Set("inventory", inventory)
+			viper.Set("cluster-selector", tt.selector)
+			viper.Set("kubeconfig-contexts", tt.contexts)
+			if got := ClusterNames(ReadClustersOrDie()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadClustersOrDie() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	viper.Reset()
+	viper.Set("inventory", inventory)
+	viper.Set("client.qps", 20)
+	viper.Set("client.as", "fetcher")
+	clusters := ClustersByName(ReadClustersOrDie())
+	want := &ClientSettings{ImpersonateUser: "fetcher", QPS: 50, Proxy: "http://proxy.eu:3128"}
+	if got := clusters["prod-eu-1"].Client; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadClustersOrDie() client = %+v, want %+v", got, want)
+	}
+	want = &ClientSettings{ImpersonateUser: "fetcher", QPS: 20}
+	if got := clusters["dev"].Client; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadClustersOrDie() client = %+v, want %+v", got, want)
+	}
+	if got, want := clusters["prod-eu-1"].Kubeconfig, filepath.Join(dir, "kubeconfigs/prod-eu-1"); got != want {
+		t.Errorf("ReadClustersOrDie() relative kubeconfig = %q, want %q", got, want)
+	}
+	if got, want := clusters["prod-eu-1"].Context, "admin@prod-eu-1"; got != want {
+		t.Errorf("ReadClustersOrDie() context = %q, want %q", got, want)
+	}
+	if got := clusters["dev"].Kubeconfig; got != "" {
+		t.Errorf("ReadClustersOrDie() kubeconfig = %q, want empty", got)
+	}
+}
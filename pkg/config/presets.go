@@ -0,0 +1,161 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+// preset is a built-in config for a common kind.
+type preset struct {
+	// key is the GVK key the preset is written for; its group and kind must match the key of a config using it
+	key string
+	raw rawGVK
+}
+
+// ignoreSystemAnnotations are written by kubectl rather than by whoever owns the object.
+var ignoreSystemAnnotations = []string{
+	`^kubectl\.kubernetes\.io/last-applied-configuration$`,
+}
+
+var presets = map[string]*preset{
+	"deployment": {
+		key: "deployment.apps",
+		raw: rawGVK{
+			KeepLabels:        []string{"."},
+			KeepAnnotations:   []string{"."},
+			IgnoreAnnotations: append([]string{`^deployment\.kubernetes\.io/revision$`}, ignoreSystemAnnotations...),
+			KeepPaths:         []string{"/spec"},
+			// written as null by kubectl and dropped by the API server
+			IgnorePaths: []string{"/spec/template/metadata/creationTimestamp"},
+			Columns:     []string{"NAMESPACE=/metadata/namespace", "NAME=/metadata/name", "REPLICAS=/spec/replicas"},
+		},
+	},
+	"service": {
+		key: "service.",
+		raw: rawGVK{
+			KeepLabels:        []string{"."},
+			KeepAnnotations:   []string{"."},
+			IgnoreAnnotations: ignoreSystemAnnotations,
+			KeepPaths:         []string{"/spec"},
+			// allocated by the cluster
+			IgnorePaths: []string{"/spec/clusterIP", "/spec/clusterIPs", "/spec/healthCheckNodePort"},
+			// created by the API server
+			IgnoreNames: []string{`^default/kubernetes$`},
+			Columns:     []string{"NAMESPACE=/metadata/namespace", "NAME=/metadata/name", "TYPE=/spec/type"},
+		},
+	},
+	"ingress": {
+		key: "ingress.networking.k8s.io",
+		raw: rawGVK{
+			KeepLabels:        []string{"."},
+			KeepAnnotations:   []string{"."},
+			IgnoreAnnotations: ignoreSystemAnnotations,
+			KeepPaths:         []string{"/spec"},
+		},
+	},
+	"configmap": {
+		key: "configmap.",
+		raw: rawGVK{
+			KeepLabels:        []string{"."},
+			KeepAnnotations:   []string{"."},
+			IgnoreAnnotations: ignoreSystemAnnotations,
+			// add /binaryData if it is used; it is left out since most config maps don't have it
+			KeepPaths: []string{"/data"},
+			// published to every namespace by the cluster
+			IgnoreNames: []string{`/kube-root-ca\.crt$`},
+		},
+	},
+}
+
+// PresetNames returns the names of the built-in presets in order.
+func PresetNames() []string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupPreset(name string) (*preset, error) {
+	p, ok := presets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset %q (presets: %s)", name, strings.Join(PresetNames(), ", "))
+	}
+	return p, nil
+}
+
+// applyPresetOrDie returns raw with the fields it doesn't set taken from its preset. set has the keys set in the config
+// so that lists set to [] replace the preset's too. raw is returned as is if it has no preset.
+func applyPresetOrDie(key string, raw *rawGVK, set map[string]interface{}) *rawGVK {
+	if len(raw.Preset) == 0 {
+		return raw
+	}
+	p, err := lookupPreset(raw.Preset)
+	if err != nil {
+		panic(util.ConfigErrorf("invalid preset for %q: %v", key, err))
+	}
+	group, _, kind := parseGVKString(key)
+	presetGroup, _, presetKind := parseGVKString(p.key)
+	if group != presetGroup || !strings.EqualFold(kind, presetKind) {
+		panic(util.ConfigErrorf("preset %q is for %q but is used by %q", raw.Preset, p.key, key))
+	}
+	merged := *raw
+	orPreset := func(field string, s, preset []string) []string {
+		if _, ok := set[field]; ok {
+			return s
+		}
+		return preset
+	}
+	merged.KeepLabels = orPreset("keep-labels", raw.KeepLabels, p.raw.KeepLabels)
+	merged.IgnoreLabels = orPreset("ignore-labels", raw.IgnoreLabels, p.raw.IgnoreLabels)
+	merged.KeepAnnotations = orPreset("keep-annotations", raw.KeepAnnotations, p.raw.KeepAnnotations)
+	merged.IgnoreAnnotations = orPreset("ignore-annotations", raw.IgnoreAnnotations, p.raw.IgnoreAnnotations)
+	merged.KeepPaths = orPreset("keep-paths", raw.KeepPaths, p.raw.KeepPaths)
+	merged.IgnorePaths = orPreset("ignore-paths", raw.IgnorePaths, p.raw.IgnorePaths)
+	merged.IgnoreNames = orPreset("ignore-names", raw.IgnoreNames, p.raw.IgnoreNames)
+	merged.PathValueFilters = orPreset("path-value-filters", raw.PathValueFilters, p.raw.PathValueFilters)
+	merged.Columns = orPreset("columns", raw.Columns, p.raw.Columns)
+	return &merged
+}
+
+// WritePreset writes the rules of the named preset to w as a GVK block of the config file.
+func WritePreset(w io.Writer, name string) error {
+	p, err := lookupPreset(name)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "# rules of preset %q; a GVK block with preset = %q can set any of them to override it\n", name, name)
+	fmt.Fprintf(w, "[gvk.%q]\n", p.key)
+	for _, field := range []struct {
+		key    string
+		values []string
+	}{
+		{"keep-labels", p.raw.KeepLabels},
+		{"ignore-labels", p.raw.IgnoreLabels},
+		{"keep-annotations", p.raw.KeepAnnotations},
+		{"ignore-annotations", p.raw.IgnoreAnnotations},
+		{"keep-paths", p.raw.KeepPaths},
+		{"ignore-paths", p.raw.IgnorePaths},
+		{"ignore-names", p.raw.IgnoreNames},
+		{"path-value-filters", p.raw.PathValueFilters},
+		{"columns", p.raw.Columns},
+	} {
+		if len(field.values) == 0 {
+			fmt.Fprintf(w, "    %s = []\n", field.key)
+			continue
+		}
+		fmt.Fprintf(w, "    %s = [\n", field.key)
+		for _, v := range field.values {
+			// Go escapes are valid TOML escapes for the ASCII in presets
+			fmt.Fprintf(w, "        %s,\n", strconv.Quote(v))
+		}
+		fmt.Fprintf(w, "    ]\n")
+	}
+	return nil
+}
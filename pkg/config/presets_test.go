@@ -0,0 +1,87 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+func readGVKFromTOML(t *testing.T, toml string) map[string]*GVK {
+	dir, err := ioutil.TempDir("", "mcfetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+	if err := ioutil.WriteFile(path, []byte(toml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	viper.Reset()
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	return ReadGVKOrDie()
+}
+
+func TestReadGVKOrDie_Preset(t *testing.T) {
+	defer viper.Reset()
+	gvkConfigs := readGVKFromTOML(t, `
+[gvk."service."]
+    preset = "service"
+    keep-labels = ["^app$"]
+    ignore-paths = []
+`)
+	got := gvkConfigs["service."]
+	if len(got.KeepLabels) != 1 || got.KeepLabels[0].String() != "^app$" {
+		t.Errorf("KeepLabels = %v, want [^app$]", got.KeepLabels)
+	}
+	if len(got.IgnorePaths) != 0 {
+		t.Errorf("IgnorePaths = %v, want []", got.IgnorePaths)
+	}
+	if want := []string{"/spec"}; !reflect.DeepEqual(got.KeepPaths, want) {
+		t.Errorf("KeepPaths = %v, want %v", got.KeepPaths, want)
+	}
+	if len(got.IgnoreAnnotations) != 1 || !got.IgnoreAnnotations[0].MatchString(
+		"kubectl.kubernetes.io/last-applied-configuration") {
+		t.Errorf("IgnoreAnnotations = %v, want last-applied-configuration", got.IgnoreAnnotations)
+	}
+}
+
+func TestWritePreset(t *testing.T) {
+	defer viper.Reset()
+	for _, name := range PresetNames() {
+		t.Run(name, func(t *testing.T) {
+			// the written rules are the same config as the preset
+			var b bytes.Buffer
+			if err := WritePreset(&b, name); err != nil {
+				t.Fatalf("WritePreset() error = %v", err)
+			}
+			key := presets[name].key
+			written := readGVKFromTOML(t, b.String())[key]
+			preset := readGVKFromTOML(t, "[gvk.\""+key+"\"]\npreset = \""+name+"\"\n")[key]
+			if written.Hash != preset.Hash {
+				t.Errorf("hash of written rules = %s, want %s", written.Hash, preset.Hash)
+			}
+		})
+	}
+	if err := WritePreset(ioutil.Discard, "nope"); err == nil {
+		t.Errorf("WritePreset() error = nil, want unknown preset")
+	}
+}
+
+func Test_applyPresetOrDie_wrongKind(t *testing.T) {
+	defer func() {
+		if _, ok := recover().(*util.ConfigError); !ok {
+			t.Errorf("applyPresetOrDie() didn't panic with a *util.ConfigError")
+		}
+	}()
+	applyPresetOrDie("deployment.apps", &rawGVK{Preset: "service"}, nil)
+}
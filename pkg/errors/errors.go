@@ -1,25 +1,68 @@
 package errors
 
 import (
+	ctx "context"
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"net"
+	"net/url"
 	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
 )
 
-type kvErr struct {
+// Class is what kind of failure an error is, for grouping and counting errors.
+type Class string
+
+const (
+	// ClassAuth means the credentials were missing, expired, or rejected.
+	ClassAuth Class = "auth"
+	// ClassForbidden means the credentials are not allowed to do what was asked.
+	ClassForbidden Class = "forbidden"
+	ClassNotFound  Class = "not-found"
+	// ClassNoKindMatch means the cluster doesn't serve the GVK.
+	ClassNoKindMatch Class = "no-kind-match"
+	ClassTimeout     Class = "timeout"
+	// ClassNetwork means the API server couldn't be reached.
+	ClassNetwork Class = "network"
+	// ClassDecode means a response or file couldn't be parsed.
+	ClassDecode   Class = "decode"
+	ClassSanitize Class = "sanitize"
+	// ClassCache means a cache file couldn't be read or written (e.g. the disk is full or permission was denied).
+	ClassCache Class = "cache"
+	// ClassUnknown is everything else.
+	ClassUnknown Class = "unknown"
+)
+
+// Error is an error with a message, the keys and values it is about (e.g. context and gvk), an optional cause, and an
+// optional class. It works with errors.Is and errors.As through its cause and marshals to JSON.
+type Error struct {
 	cause         error
 	keysAndValues []interface{}
 	message       string
+	class         Class
 }
 
-func New(cause error, message string, keysAndValues ...interface{}) *kvErr {
-	return &kvErr{
+var _ json.Marshaler = &Error{}
+
+func New(cause error, message string, keysAndValues ...interface{}) *Error {
+	return &Error{
 		cause:         cause,
 		message:       message,
 		keysAndValues: keysAndValues,
 	}
 }
 
-func (e *kvErr) Error() string {
+// WithClass sets the class of e, overriding the class of its cause, and returns e.
+func (e *Error) WithClass(class Class) *Error {
+	e.class = class
+	return e
+}
+
+func (e *Error) Error() string {
 	var kvs []string
 	// copy-and-paste logic from zap logger
 	for i := 0; i < len(e.keysAndValues); {
@@ -45,3 +88,108 @@ func (e *kvErr) Error() string {
 	}
 	return msg
 }
+
+// Message returns the message without fields or cause.
+func (e *Error) Message() string {
+	return e.message
+}
+
+// Fields returns the keys and values of e. Keys are formatted as strings.
+func (e *Error) Fields() map[string]interface{} {
+	fields := map[string]interface{}{}
+	for i := 0; i+1 < len(e.keysAndValues); i += 2 {
+		fields[fmt.Sprint(e.keysAndValues[i])] = e.keysAndValues[i+1]
+	}
+	return fields
+}
+
+// Cause returns the error e wraps or nil. It is for github.com/pkg/errors.Cause.
+func (e *Error) Cause() error {
+	return e.cause
+}
+
+// Unwrap returns the error e wraps or nil. It is for errors.Is and errors.As.
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Class returns the class of e. See Classify.
+func (e *Error) Class() Class {
+	return Classify(e)
+}
+
+type jsonError struct {
+	Message string                 `json:"message"`
+	Class   Class                  `json:"class"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+	Cause   string                 `json:"cause,omitempty"`
+	// Error is the whole message as returned by Error().
+	Error string `json:"error"`
+}
+
+func (e *Error) MarshalJSON() ([]byte, error) {
+	je := jsonError{
+		Message: e.message,
+		Class:   e.Class(),
+		Fields:  e.Fields(),
+		Error:   e.Error(),
+	}
+	if e.cause != nil {
+		je.Cause = e.cause.Error()
+	}
+	return json.Marshal(je)
+}
+
+// Classify returns the class of err. The class set on the outermost *Error wins; otherwise the chain of causes is
+// searched for a Kubernetes API error, network error, or decode error.
+func Classify(err error) Class {
+	for e := err; e != nil; e = unwrap(e) {
+		if oe, ok := e.(*Error); ok && len(oe.class) > 0 {
+			return oe.class
+		}
+		if class := classify(e); len(class) > 0 {
+			return class
+		}
+	}
+	return ClassUnknown
+}
+
+// classify returns the class of err alone or "" if it isn't known.
+func classify(err error) Class {
+	switch {
+	case apierrors.IsUnauthorized(err):
+		return ClassAuth
+	case apierrors.IsForbidden(err):
+		return ClassForbidden
+	case apierrors.IsNotFound(err):
+		return ClassNotFound
+	case meta.IsNoMatchError(err):
+		return ClassNoKindMatch
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err), err == ctx.DeadlineExceeded:
+		return ClassTimeout
+	case utilnet.IsConnectionRefused(err), utilnet.IsConnectionReset(err):
+		return ClassNetwork
+	}
+	switch e := err.(type) {
+	// client-go returns *url.Error when a request fails
+	case *url.Error, *net.OpError, *net.DNSError:
+		if e.(net.Error).Timeout() {
+			return ClassTimeout
+		}
+		return ClassNetwork
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return ClassDecode
+	}
+	return ""
+}
+
+// unwrap returns the cause of err using either Unwrap (the standard library) or Cause (github.com/pkg/errors).
+func unwrap(err error) error {
+	if cause := stderrors.Unwrap(err); cause != nil {
+		return cause
+	}
+	if c, ok := err.(interface{ Cause() error }); ok {
+		return c.Cause()
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package errors
+
+import (
+	ctx "context"
+	"encoding/json"
+	stderrors "errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestClassify(t *testing.T) {
+	gr := schema.GroupResource{Resource: "pods"}
+	tests := []struct {
+		name string
+		err  error
+		want Class
+	}{
+		{name: "nil", err: nil, want: ClassUnknown},
+		{name: "plain", err: stderrors.New("boom"), want: ClassUnknown},
+		{name: "unauthorized", err: apierrors.NewUnauthorized("no"), want: ClassAuth},
+		{name: "forbidden", err: apierrors.NewForbidden(gr, "a", nil), want: ClassForbidden},
+		{name: "not found", err: apierrors.NewNotFound(gr, "a"), want: ClassNotFound},
+		{name: "no kind match", err: &meta.NoKindMatchError{GroupKind: schema.GroupKind{Kind: "Foo"}},
+			want: ClassNoKindMatch},
+		{name: "server timeout", err: apierrors.NewTimeoutError("slow", 1), want: ClassTimeout},
+		{name: "deadline", err: ctx.DeadlineExceeded, want: ClassTimeout},
+		{name: "network", err: &url.Error{Op: "Get", URL: "https://a", Err: stderrors.New("dial tcp: no route")},
+			want: ClassNetwork},
+		{name: "decode", err: json.Unmarshal([]byte("{"), &struct{}{}), want: ClassDecode},
+		{name: "wrapped by pkg/errors", err: pkgerrors.Wrapf(apierrors.NewForbidden(gr, "a", nil), "failed"),
+			want: ClassForbidden},
+		{name: "wrapped by Error", err: New(New(apierrors.NewNotFound(gr, "a"), "inner"), "outer"),
+			want: ClassNotFound},
+		{name: "explicit", err: New(apierrors.NewNotFound(gr, "a"), "failed").WithClass(ClassSanitize),
+			want: ClassSanitize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Classify() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestError_IsAs(t *testing.T) {
+	cause := apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "a", nil)
+	var err error = New(cause, "failed to list", "context", "c1")
+
+	var oe *Error
+	if !stderrors.As(err, &oe) {
+		t.Fatalf("As() = false, want true")
+	}
+	if !stderrors.Is(err, cause) {
+		t.Errorf("Is() = false, want true")
+	}
+	var statusErr *apierrors.StatusError
+	if !stderrors.As(err, &statusErr) {
+		t.Errorf("As(*StatusError) = false, want true")
+	}
+	if pkgerrors.Cause(err) != cause {
+		t.Errorf("Cause() = %v, want %v", pkgerrors.Cause(err), cause)
+	}
+	if oe.Message() != "failed to list" {
+		t.Errorf("Message() = %q", oe.Message())
+	}
+	if want := map[string]interface{}{"context": "c1"}; !reflect.DeepEqual(oe.Fields(), want) {
+		t.Errorf("Fields() = %v, want %v", oe.Fields(), want)
+	}
+}
+
+func TestError_MarshalJSON(t *testing.T) {
+	err := New(apierrors.NewUnauthorized("expired"), "failed to list", "gvk", "pod.", "context", "c1")
+	b, jsonErr := json.Marshal(err)
+	if jsonErr != nil {
+		t.Fatalf("Marshal() error = %v", jsonErr)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	want := map[string]interface{}{
+		"message": "failed to list",
+		"class":   "auth",
+		"fields":  map[string]interface{}{"gvk": "pod.", "context": "c1"},
+		"cause":   "expired",
+		"error":   "failed to list gvk=pod. context=c1: expired",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Marshal() = %s, want %v", b, want)
+	}
+}
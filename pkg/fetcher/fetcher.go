@@ -0,0 +1,372 @@
+package fetcher
+
+import (
+	ctx "context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/mlowery/mcfetcher/pkg/cache"
+	"github.com/mlowery/mcfetcher/pkg/config"
+	oerrors "github.com/mlowery/mcfetcher/pkg/errors"
+	"github.com/mlowery/mcfetcher/pkg/metrics"
+	"github.com/mlowery/mcfetcher/pkg/source"
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+const defaultConcurrency = 10
+
+// ProgressType identifies what happened in a Progress.
+type ProgressType string
+
+const (
+	ContextStarted ProgressType = "ContextStarted"
+	GVKStarted     ProgressType = "GVKStarted"
+	// GVKPage is sent after each page of a list.
+	GVKPage     ProgressType = "GVKPage"
+	GVKDone     ProgressType = "GVKDone"
+	ContextDone ProgressType = "ContextDone"
+)
+
+// Progress is passed to Options.OnProgress.
+type Progress struct {
+	Type    ProgressType
+	Context string
+	// GVK is empty for ContextStarted and ContextDone.
+	GVK string
+	// Result is only set for GVKDone.
+	Result *Result
+	// Pages and Listed are the pages and objects listed so far. They are only set for GVKPage.
+	Pages  int
+	Listed int
+}
+
+type Options struct {
+	Contexts []string
+	// ContextLabels are the inventory labels of each context. They are recorded in the cache metadata.
+	ContextLabels map[string]map[string]string
+	GVKConfigs    map[string]*config.GVK
+	// Store is checked before listing from the source and written to afterwards.
+	Store cache.Store
+	// Sources returns where to list the objects of each context from. Defaults to live clusters loaded with the
+	// default kubeconfig loading rules.
+	Sources source.Factory
+	// Concurrency is the number of contexts processed at once. Defaults to 10.
+	Concurrency int
+	// Logger defaults to a no-op logger.
+	Logger *zap.SugaredLogger
+	// OnProgress, if set, is called as work progresses. It is called from multiple goroutines.
+	OnProgress func(*Progress)
+	// CollectObjects keeps the sanitized objects in Result.Objects. Without it, objects are streamed from the source
+	// to the store one at a time and only counted, which keeps memory bounded on huge lists.
+	CollectObjects bool
+	// MaxErrors stops the run once this many errors have occurred: lists in progress are cancelled and remaining
+	// work is skipped, so Run returns fewer results than contexts times GVKs. 0 means no limit.
+	MaxErrors int
+}
+
+// Result is the outcome of one (context, GVK).
+type Result struct {
+	Context string
+	GVK     string
+	// Objects are the sanitized objects if Options.CollectObjects is set. They are nil if Err is set.
+	Objects []*unstructured.Unstructured
+	// FromCache is true if the objects were already in the store instead of listed from the source.
+	FromCache bool
+	// ListedCount is the number of objects returned by the source before sanitizing.
+	ListedCount int
+	// SanitizedCount is the number of objects kept after sanitizing. It is not set for results from the cache.
+	SanitizedCount int
+	Duration       time.Duration
+	// Absent is true if the source doesn't serve the GVK and it isn't required. It is not an error; no objects are
+	// stored and the cache records the GVK as absent.
+	Absent bool
+	// ServedVersion is the version the objects were listed in (e.g. the group's preferred version for a config without
+	// one). It is empty if unknown.
+	ServedVersion string
+	// RateLimitWait is how long list requests were held back by rate limits.
+	RateLimitWait time.Duration
+	// Err is set if no objects could be produced.
+	Err error
+	// SanitizeErrs holds objects that failed to sanitize. They are left out of Objects.
+	SanitizeErrs []error
+}
+
+// Errors returns Err and SanitizeErrs.
+func (r *Result) Errors() []error {
+	if r.Err != nil {
+		return append([]error{r.Err}, r.SanitizeErrs...)
+	}
+	return r.SanitizeErrs
+}
+
+type Fetcher struct {
+	opts Options
+}
+
+func New(opts Options) (*Fetcher, error) {
+	if len(opts.Contexts) == 0 {
+		return nil, errors.Errorf("at least one context is required")
+	}
+	if len(opts.GVKConfigs) == 0 {
+		return nil, errors.Errorf("at least one gvk config is required")
+	}
+	if opts.Store == nil {
+		return nil, errors.Errorf("store is required")
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop().Sugar()
+	}
+	if opts.Sources == nil {
+		sources, err := source.NewFactory("", source.LiveOptions{Logger: opts.Logger})
+		if err != nil {
+			return nil, err
+		}
+		opts.Sources = sources
+	}
+	return &Fetcher{opts: opts}, nil
+}
+
+// Run fetches every (context, GVK) and returns the results once all are done or the run is stopped (see
+// Options.MaxErrors).
+func (f *Fetcher) Run(c ctx.Context) []*Result {
+	c, cancel := ctx.WithCancel(c)
+	defer cancel()
+	var errorCount int32
+	var stopOnce sync.Once
+	onResult := func(r *Result) {
+		n := atomic.AddInt32(&errorCount, int32(len(r.Errors())))
+		if f.opts.MaxErrors > 0 && int(n) >= f.opts.MaxErrors {
+			stopOnce.Do(func() {
+				f.opts.Logger.Warnw("stopping early", "errorCount", n, "maxErrors", f.opts.MaxErrors)
+				cancel()
+			})
+		}
+	}
+
+	var wg sync.WaitGroup
+	contextCh := make(chan string)
+	var mu sync.Mutex
+	var results []*Result
+
+	for w := 1; w <= f.opts.Concurrency; w++ {
+		wg.Add(1)
+		go func(logger *zap.SugaredLogger) {
+			defer wg.Done()
+			for context := range contextCh {
+				if c.Err() != nil {
+					// stopped; drain the remaining contexts
+					continue
+				}
+				r := f.fetchContext(c, logger.With("context", context), context, onResult)
+				mu.Lock()
+				results = append(results, r...)
+				mu.Unlock()
+			}
+		}(f.opts.Logger.With("worker", w))
+	}
+
+	for _, context := range f.opts.Contexts {
+		contextCh <- context
+	}
+	close(contextCh)
+	wg.Wait()
+	return results
+}
+
+func (f *Fetcher) progress(p *Progress) {
+	if f.opts.OnProgress != nil {
+		f.opts.OnProgress(p)
+	}
+}
+
+// fetchContext calls onResult with each result as soon as it is done.
+func (f *Fetcher) fetchContext(c ctx.Context, logger *zap.SugaredLogger, context string,
+	onResult func(*Result)) []*Result {
+	logger.Infow("processing context")
+	f.progress(&Progress{Type: ContextStarted, Context: context})
+	var results []*Result
+	// the source is created on first use so that fully cached contexts never talk to Kube
+	var src source.Source
+	var srcErr error
+	getSource := func() (source.Source, error) {
+		if src == nil && srcErr == nil {
+			src, srcErr = f.opts.Sources(context)
+			if srcErr != nil {
+				metrics.Errors.WithLabelValues(context, "", string(oerrors.Classify(srcErr))).Inc()
+				srcErr = oerrors.New(srcErr, "failed to create source", "context", context)
+			}
+		}
+		return src, srcErr
+	}
+	for gvkString, gvkConfig := range f.opts.GVKConfigs {
+		if c.Err() != nil {
+			break
+		}
+		f.progress(&Progress{Type: GVKStarted, Context: context, GVK: gvkString})
+		r := f.fetchGVK(c, logger.With("gvk", gvkString), context, gvkString, gvkConfig, getSource)
+		if r.Err != nil && c.Err() != nil {
+			// cancelled, which isn't a failure of its own
+			break
+		}
+		f.progress(&Progress{Type: GVKDone, Context: context, GVK: gvkString, Result: r})
+		results = append(results, r)
+		onResult(r)
+	}
+	f.progress(&Progress{Type: ContextDone, Context: context})
+	return results
+}
+
+func (f *Fetcher) fetchGVK(c ctx.Context, logger *zap.SugaredLogger, context, gvkString string, gvkConfig *config.GVK,
+	getSource func() (source.Source, error)) *Result {
+	start := time.Now()
+	r := &Result{Context: context, GVK: gvkString}
+	defer func() {
+		r.Duration = time.Since(start)
+	}()
+	failErr := func(err *oerrors.Error) *Result {
+		metrics.Errors.WithLabelValues(context, gvkString, string(err.Class())).Inc()
+		r.Err = err
+		return r
+	}
+	fail := func(err error, message string) *Result {
+		return failErr(oerrors.New(err, message, "gvk", gvkString, "context", context))
+	}
+	// failCache is fail for errors of the store, which would otherwise be classified by their cause (e.g. decode)
+	failCache := func(err error, message string) *Result {
+		return failErr(oerrors.New(err, message, "gvk", gvkString, "context", context).WithClass(oerrors.ClassCache))
+	}
+
+	// if there is something in the store, don't call Kube since that is the most expensive part
+	cached, err := f.opts.Store.Exists(context, gvkString)
+	if err != nil {
+		return failCache(err, "failed to read cached records")
+	}
+	if cached {
+		metrics.CacheHits.WithLabelValues(context, gvkString).Inc()
+		r.FromCache = true
+		meta, err := f.opts.Store.GetMeta(context, gvkString)
+		if err != nil {
+			return failCache(err, "failed to read cached records")
+		}
+		if meta != nil {
+			r.Absent = meta.Absent
+			r.ServedVersion = meta.ServedVersion
+		}
+		if f.opts.CollectObjects {
+			if r.Objects, err = f.opts.Store.Get(context, gvkString); err != nil {
+				return failCache(err, "failed to read cached records")
+			}
+		}
+		logger.Named(util.ComponentCache).Infow("using cached results (to skip cache, delete file)")
+		return r
+	}
+	metrics.CacheMisses.WithLabelValues(context, gvkString).Inc()
+
+	src, err := getSource()
+	if err != nil {
+		// already counted when the source was created
+		r.Err = err
+		return r
+	}
+
+	w, err := f.opts.Store.NewWriter(context, gvkString)
+	if err != nil {
+		return failCache(err, "failed to write sanitized records")
+	}
+	// each object is sanitized and written as soon as it is listed so only one page is held in memory at a time
+	var writeErr error
+	logger.Infow("listing all", "metadataOnly", gvkConfig.MetadataOnly)
+	// GVKs of a context are listed one at a time so the difference is what this list waited
+	if waiter, ok := src.(source.Waiter); ok {
+		waitedBefore := waiter.Waited()
+		defer func() {
+			r.RateLimitWait = waiter.Waited() - waitedBefore
+		}()
+	}
+	// pages are reported from the pager's goroutine
+	var listed int64
+	pageCtx := source.WithOnPage(c, func(pages int) {
+		f.progress(&Progress{Type: GVKPage, Context: context, GVK: gvkString, Pages: pages,
+			Listed: int(atomic.LoadInt64(&listed))})
+	})
+	sanitizeLogger := logger.Named(util.ComponentSanitize)
+	listStart := time.Now()
+	err = src.Each(pageCtx, gvkConfig, func(uObj *unstructured.Unstructured) error {
+		r.ListedCount++
+		atomic.AddInt64(&listed, 1)
+		if len(r.ServedVersion) == 0 {
+			r.ServedVersion = uObj.GroupVersionKind().Version
+		}
+		sanObj, err := util.Sanitize(sanitizeLogger, uObj, gvkConfig.IgnoreNames, gvkConfig.PathValueFilters,
+			gvkConfig.KeepAnnotations, gvkConfig.IgnoreAnnotations, gvkConfig.KeepLabels, gvkConfig.IgnoreLabels,
+			gvkConfig.KeepPaths, gvkConfig.IgnorePaths, gvkConfig.KeepDeleted)
+		if err != nil {
+			metrics.Errors.WithLabelValues(context, gvkString, string(oerrors.ClassSanitize)).Inc()
+			r.SanitizeErrs = append(r.SanitizeErrs, oerrors.New(err, "failed to sanitize",
+				"gvk", gvkString, "context", context, "name", uObj.GetName()).WithClass(oerrors.ClassSanitize))
+			return nil
+		}
+		if sanObj == nil {
+			return nil
+		}
+		if writeErr = w.Write(sanObj); writeErr != nil {
+			return writeErr
+		}
+		r.SanitizedCount++
+		if f.opts.CollectObjects {
+			r.Objects = append(r.Objects, sanObj)
+		}
+		return nil
+	})
+	rtt := time.Since(listStart)
+	metrics.ListDuration.WithLabelValues(context, gvkString).Observe(rtt.Seconds())
+	metrics.ObjectsListed.WithLabelValues(context, gvkString).Add(float64(r.ListedCount))
+	if err != nil && writeErr == nil && !gvkConfig.Required && oerrors.Classify(err) == oerrors.ClassNoKindMatch {
+		// e.g. a CRD that is only installed in some clusters; nothing has been written
+		logger.Infow("not served; recording as absent (set required to make this an error)")
+		r.Absent = true
+		if err := w.Commit(&cache.Meta{ConfigHash: gvkConfig.Hash, Labels: f.opts.ContextLabels[context],
+			Absent: true}); err != nil {
+			return failCache(err, "failed to write sanitized records")
+		}
+		return r
+	}
+	if err != nil {
+		w.Abort()
+		r.Objects = nil
+		if writeErr != nil {
+			return failCache(err, "failed to write sanitized records")
+		}
+		if oerrors.Classify(err) == oerrors.ClassNoKindMatch {
+			return fail(err, "failed to list required GVK")
+		}
+		return fail(err, "failed to list")
+	}
+	if resolver, ok := src.(source.VersionResolver); ok {
+		// also known when nothing was listed
+		if r.ServedVersion, err = resolver.ServedVersion(gvkConfig); err != nil {
+			w.Abort()
+			r.Objects = nil
+			return fail(err, "failed to get served version")
+		}
+	}
+	logger.Infow("listed", "duration", rtt, "servedVersion", r.ServedVersion)
+	metrics.ObjectsKept.WithLabelValues(context, gvkString).Add(float64(r.SanitizedCount))
+
+	logger.Named(util.ComponentCache).Infow("caching", "origObjCount", r.ListedCount, "sanitizedObjCount", r.SanitizedCount)
+	meta := &cache.Meta{ConfigHash: gvkConfig.Hash, Labels: f.opts.ContextLabels[context],
+		ServedVersion: r.ServedVersion}
+	if err := w.Commit(meta); err != nil {
+		r.Objects = nil
+		return failCache(err, "failed to write sanitized records")
+	}
+	return r
+}
@@ -0,0 +1,207 @@
+package fetcher
+
+import (
+	ctx "context"
+	"encoding/json"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/mlowery/mcfetcher/pkg/cache"
+	"github.com/mlowery/mcfetcher/pkg/config"
+	oerrors "github.com/mlowery/mcfetcher/pkg/errors"
+	"github.com/mlowery/mcfetcher/pkg/source"
+)
+
+func TestFetcher_RunFromCache(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetName("a")
+	store := cache.NewMemStore()
+	store.Put("c1", "namespace.", []*unstructured.Unstructured{obj}, nil)
+	store.Put("c2", "namespace.", []*unstructured.Unstructured{obj, obj}, nil)
+	var mu sync.Mutex
+	progress := map[ProgressType]int{}
+	f, err := New(Options{
+		Contexts:   []string{"c1", "c2"},
+		GVKConfigs: map[string]*config.GVK{"namespace.": {}},
+		Store:      store,
+		// objects are only returned when collected
+		CollectObjects: true,
+		OnProgress: func(p *Progress) {
+			mu.Lock()
+			defer mu.Unlock()
+			progress[p.Type]++
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	results := f.Run(ctx.Background())
+	if len(results) != 2 {
+		t.Fatalf("Run() got %d results, want 2", len(results))
+	}
+	for _, r := range results {
+		if len(r.Errors()) > 0 {
+			t.Errorf("Run() context %s errors = %v", r.Context, r.Errors())
+		}
+		if !r.FromCache {
+			t.Errorf("Run() context %s FromCache = false, want true", r.Context)
+		}
+		stored, _ := store.Get(r.Context, r.GVK)
+		if want := len(stored); len(r.Objects) != want {
+			t.Errorf("Run() context %s got %d objects, want %d", r.Context, len(r.Objects), want)
+		}
+	}
+	for _, pt := range []ProgressType{ContextStarted, GVKStarted, GVKDone, ContextDone} {
+		if progress[pt] != 2 {
+			t.Errorf("Run() got %d %s progress calls, want 2", progress[pt], pt)
+		}
+	}
+}
+
+type fakeSource struct {
+	objs []*unstructured.Unstructured
+	// err is returned after the objects are passed to fn
+	err error
+}
+
+func (s *fakeSource) Each(c ctx.Context, gvk *config.GVK, fn func(*unstructured.Unstructured) error) error {
+	for _, obj := range s.objs {
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+	return s.err
+}
+
+func TestFetcher_RunStreamsToStore(t *testing.T) {
+	var objs []*unstructured.Unstructured
+	for _, name := range []string{"a", "b", "c"} {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		obj.SetName(name)
+		objs = append(objs, obj)
+	}
+	store := cache.NewMemStore()
+	f, err := New(Options{
+		Contexts:   []string{"c1"},
+		GVKConfigs: map[string]*config.GVK{"namespace.": {}},
+		Store:      store,
+		Sources: func(context string) (source.Source, error) {
+			return &fakeSource{objs: objs}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	results := f.Run(ctx.Background())
+	if len(results) != 1 {
+		t.Fatalf("Run() got %d results, want 1", len(results))
+	}
+	r := results[0]
+	if len(r.Errors()) > 0 {
+		t.Fatalf("Run() errors = %v", r.Errors())
+	}
+	if r.FromCache {
+		t.Errorf("Run() FromCache = true, want false")
+	}
+	if r.Objects != nil {
+		t.Errorf("Run() got %d objects, want none without CollectObjects", len(r.Objects))
+	}
+	if r.ListedCount != 3 || r.SanitizedCount != 3 {
+		t.Errorf("Run() ListedCount = %d, SanitizedCount = %d, want 3 and 3", r.ListedCount, r.SanitizedCount)
+	}
+	if stored, _ := store.Get("c1", "namespace."); len(stored) != 3 {
+		t.Errorf("Run() stored %d objects, want 3", len(stored))
+	}
+}
+
+func TestFetcher_RunAbsent(t *testing.T) {
+	notServed := errors.Wrapf(&meta.NoKindMatchError{GroupKind: schema.GroupKind{Kind: "Foo"}},
+		"failed to get rest mapping")
+	tests := []struct {
+		name       string
+		required   bool
+		wantAbsent bool
+		wantErr    bool
+	}{
+		{name: "optional", wantAbsent: true},
+		{name: "required", required: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := cache.NewMemStore()
+			f, err := New(Options{
+				Contexts:   []string{"c1"},
+				GVKConfigs: map[string]*config.GVK{"foo.example.com": {Required: tt.required}},
+				Store:      store,
+				Sources: func(context string) (source.Source, error) {
+					return &fakeSource{err: notServed}, nil
+				},
+			})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			r := f.Run(ctx.Background())[0]
+			if (r.Err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", r.Err, tt.wantErr)
+			}
+			if r.Absent != tt.wantAbsent {
+				t.Errorf("Run() Absent = %v, want %v", r.Absent, tt.wantAbsent)
+			}
+			m, _ := store.GetMeta("c1", "foo.example.com")
+			if gotAbsent := m != nil && m.Absent; gotAbsent != tt.wantAbsent {
+				t.Errorf("Run() stored absent = %v, want %v", gotAbsent, tt.wantAbsent)
+			}
+			if !tt.wantAbsent {
+				return
+			}
+
+			// the marker is a cache hit on the next run
+			r = f.Run(ctx.Background())[0]
+			if !r.FromCache || !r.Absent {
+				t.Errorf("Run() from cache FromCache = %v, Absent = %v, want true and true", r.FromCache, r.Absent)
+			}
+		})
+	}
+}
+
+// failingStore fails every read and write with err.
+type failingStore struct {
+	*cache.MemStore
+	err error
+}
+
+func (s *failingStore) Exists(context, gvkString string) (bool, error) {
+	return false, s.err
+}
+
+func (s *failingStore) NewWriter(context, gvkString string) (cache.Writer, error) {
+	return nil, s.err
+}
+
+func TestFetcher_RunCacheError(t *testing.T) {
+	// a parse error would be classified as decode by its cause
+	var syntaxErr error = &json.SyntaxError{}
+	for _, err := range []error{os.ErrPermission, syntaxErr} {
+		f, newErr := New(Options{
+			Contexts:   []string{"c1"},
+			GVKConfigs: map[string]*config.GVK{"namespace.": {}},
+			Store:      &failingStore{MemStore: cache.NewMemStore(), err: err},
+			Sources: func(context string) (source.Source, error) {
+				return &fakeSource{}, nil
+			},
+		})
+		if newErr != nil {
+			t.Fatalf("New() error = %v", newErr)
+		}
+		r := f.Run(ctx.Background())[0]
+		if got := oerrors.Classify(r.Err); got != oerrors.ClassCache {
+			t.Errorf("Run() error %v class = %q, want %q", r.Err, got, oerrors.ClassCache)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package fetcher
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FailedContexts returns the contexts with at least one error in results, sorted.
+func FailedContexts(results []*Result) []string {
+	failed := map[string]bool{}
+	for _, r := range results {
+		if len(r.Errors()) > 0 {
+			failed[r.Context] = true
+		}
+	}
+	var contexts []string
+	for context := range failed {
+		contexts = append(contexts, context)
+	}
+	sort.Strings(contexts)
+	return contexts
+}
+
+// ParseAllowedFailures parses spec, which is either a count (e.g. 2) or a percentage of total (e.g. 10%, rounded
+// down), and returns the count. An empty spec allows none.
+func ParseAllowedFailures(spec string, total int) (int, error) {
+	if len(spec) == 0 {
+		return 0, nil
+	}
+	if strings.HasSuffix(spec, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(spec, "%"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return 0, errors.Errorf("expected a percentage between 0%% and 100%%, got %q", spec)
+		}
+		return int(percent * float64(total) / 100), nil
+	}
+	n, err := strconv.Atoi(spec)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("expected a count or a percentage, got %q", spec)
+	}
+	return n, nil
+}
@@ -0,0 +1,65 @@
+package fetcher
+
+import (
+	ctx "context"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/mlowery/mcfetcher/pkg/cache"
+	"github.com/mlowery/mcfetcher/pkg/config"
+	"github.com/mlowery/mcfetcher/pkg/source"
+)
+
+func TestFetcher_RunMaxErrors(t *testing.T) {
+	f, err := New(Options{
+		Contexts:   []string{"c1", "c2", "c3"},
+		GVKConfigs: map[string]*config.GVK{"namespace.": {}, "configmap.": {}},
+		Store:      cache.NewMemStore(),
+		Sources: func(context string) (source.Source, error) {
+			return &fakeSource{err: errors.New("boom")}, nil
+		},
+		// one worker so that nothing else is in progress when the limit is hit
+		Concurrency: 1,
+		MaxErrors:   1,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	results := f.Run(ctx.Background())
+	if len(results) != 1 {
+		t.Fatalf("Run() got %d results, want 1", len(results))
+	}
+	if got := FailedContexts(results); !reflect.DeepEqual(got, []string{"c1"}) {
+		t.Errorf("FailedContexts() = %v, want [c1]", got)
+	}
+}
+
+func TestParseAllowedFailures(t *testing.T) {
+	tests := []struct {
+		spec    string
+		total   int
+		want    int
+		wantErr bool
+	}{
+		{spec: "", total: 10, want: 0},
+		{spec: "3", total: 10, want: 3},
+		{spec: "25%", total: 10, want: 2},
+		{spec: "100%", total: 7, want: 7},
+		{spec: "-1", total: 10, wantErr: true},
+		{spec: "150%", total: 10, wantErr: true},
+		{spec: "some", total: 10, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseAllowedFailures(tt.spec, tt.total)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAllowedFailures() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAllowedFailures() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
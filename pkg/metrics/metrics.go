@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "mcfetcher"
+
+var (
+	registry = prometheus.NewRegistry()
+	// kept separate so that textfiles don't collide with the node exporter's own process metrics
+	runtimeRegistry = prometheus.NewRegistry()
+
+	ListDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "list_duration_seconds",
+		Help:      "Time taken to list all objects of a GVK from a context, including paging and retries.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"context", "gvk"})
+	ObjectsListed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "objects_listed_total",
+		Help:      "Objects returned by the API server.",
+	}, []string{"context", "gvk"})
+	ObjectsKept = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "objects_kept_total",
+		Help:      "Objects kept after sanitizing.",
+	}, []string{"context", "gvk"})
+	CacheHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_hits_total",
+		Help:      "Cache lookups that found a cache file.",
+	}, []string{"context", "gvk"})
+	CacheMisses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_misses_total",
+		Help:      "Cache lookups that did not find a cache file.",
+	}, []string{"context", "gvk"})
+	Errors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "errors_total",
+		Help:      "Errors by class (see pkg/errors.Class).",
+	}, []string{"context", "gvk", "class"})
+	Retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retries_total",
+		Help:      "List requests retried by client-go after a connection reset or a Retry-After response.",
+	}, []string{"context", "gvk"})
+	WatchEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "watch_events_total",
+		Help:      "Events emitted by watch because the sanitized form of an object changed.",
+	}, []string{"context", "gvk", "type"})
+	CacheLoads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_loads_total",
+		Help:      "Cache files (re)loaded by serve.",
+	}, []string{"context", "gvk"})
+)
+
+func init() {
+	runtimeRegistry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	registry.MustRegister(
+		ListDuration,
+		ObjectsListed,
+		ObjectsKept,
+		CacheHits,
+		CacheMisses,
+		Errors,
+		Retries,
+		WatchEvents,
+		CacheLoads,
+	)
+}
+
+// Handler returns an http.Handler that serves all metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(prometheus.Gatherers{registry, runtimeRegistry}, promhttp.HandlerOpts{})
+}
+
+// Serve serves metrics on addr at /metrics. It blocks.
+func Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	return http.ListenAndServe(addr, mux)
+}
+
+// WriteTextfile writes all metrics to path in the format read by the node exporter's textfile collector.
+func WriteTextfile(path string) error {
+	if err := prometheus.WriteToTextfile(path, registry); err != nil {
+		return errors.Wrapf(err, "failed to write metrics")
+	}
+	return nil
+}
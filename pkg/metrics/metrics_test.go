@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestWriteTextfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mcfetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mcfetcher.prom")
+
+	ObjectsListed.WithLabelValues("textfile-test", "pod.").Add(3)
+	if err := WriteTextfile(path); err != nil {
+		t.Fatalf("WriteTextfile() error = %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	families, err := new(expfmt.TextParser).TextToMetricFamilies(f)
+	if err != nil {
+		t.Fatalf("failed to parse textfile: %v", err)
+	}
+
+	family, ok := families["mcfetcher_objects_listed_total"]
+	if !ok {
+		t.Fatalf("mcfetcher_objects_listed_total missing from textfile")
+	}
+	found := false
+	for _, m := range family.GetMetric() {
+		labels := map[string]string{}
+		for _, l := range m.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if labels["context"] == "textfile-test" && labels["gvk"] == "pod." {
+			found = true
+			if got := m.GetCounter().GetValue(); got != 3 {
+				t.Errorf("mcfetcher_objects_listed_total = %v, want 3", got)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("mcfetcher_objects_listed_total{context=\"textfile-test\",gvk=\"pod.\"} missing from textfile")
+	}
+	for name := range families {
+		if !strings.HasPrefix(name, namespace+"_") {
+			t.Errorf("textfile has %s, want only %s_ metrics", name, namespace)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	CacheHits.WithLabelValues("handler-test", "pod.").Inc()
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	families, err := new(expfmt.TextParser).TextToMetricFamilies(rec.Body)
+	if err != nil {
+		t.Fatalf("failed to parse metrics: %v", err)
+	}
+	// the runtime metrics are served but not written to textfiles
+	for _, name := range []string{"go_goroutines", "process_start_time_seconds", "mcfetcher_cache_hits_total"} {
+		if _, ok := families[name]; !ok {
+			t.Errorf("%s missing from metrics", name)
+		}
+	}
+}
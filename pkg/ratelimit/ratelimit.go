@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	ctx "context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// New returns a token bucket that allows qps requests per second with bursts of up to burst requests. It returns nil
+// (no limit) if qps is not positive. burst defaults to qps rounded up.
+func New(qps float64, burst int) *rate.Limiter {
+	if qps <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = int(qps)
+		if float64(burst) < qps {
+			burst++
+		}
+	}
+	return rate.NewLimiter(rate.Limit(qps), burst)
+}
+
+// Waiter waits on a list of limiters in order (e.g. a per-cluster one and then one shared by the whole run) and keeps
+// track of how long was spent waiting. It is safe for concurrent use.
+type Waiter struct {
+	limiters []*rate.Limiter
+	// nanoseconds
+	waited int64
+}
+
+// NewWaiter returns a Waiter for limiters. nil limiters are skipped.
+func NewWaiter(limiters ...*rate.Limiter) *Waiter {
+	w := &Waiter{}
+	for _, l := range limiters {
+		if l != nil {
+			w.limiters = append(w.limiters, l)
+		}
+	}
+	return w
+}
+
+// Wait blocks until every limiter allows a request or c is done.
+func (w *Waiter) Wait(c ctx.Context) error {
+	if len(w.limiters) == 0 {
+		return nil
+	}
+	start := time.Now()
+	defer func() {
+		atomic.AddInt64(&w.waited, int64(time.Since(start)))
+	}()
+	for _, l := range w.limiters {
+		if err := l.Wait(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Waited returns the total time spent in Wait so far.
+func (w *Waiter) Waited() time.Duration {
+	return time.Duration(atomic.LoadInt64(&w.waited))
+}
+
+// WrapTransport makes every request through rt wait first. It can be used as rest.Config.WrapTransport.
+func (w *Waiter) WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	if len(w.limiters) == 0 {
+		return rt
+	}
+	return &roundTripper{waiter: w, rt: rt}
+}
+
+type roundTripper struct {
+	waiter *Waiter
+	rt     http.RoundTripper
+}
+
+func (r *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := r.waiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return r.rt.RoundTrip(req)
+}
+
+// WrappedRoundTripper lets client-go find the transport underneath.
+func (r *roundTripper) WrappedRoundTripper() http.RoundTripper {
+	return r.rt
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	ctx "context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name      string
+		qps       float64
+		burst     int
+		wantNil   bool
+		wantBurst int
+	}{
+		{name: "no limit", qps: 0, wantNil: true},
+		{name: "negative", qps: -1, wantNil: true},
+		{name: "burst defaults to qps", qps: 5, wantBurst: 5},
+		{name: "burst rounds up", qps: 0.5, wantBurst: 1},
+		{name: "burst", qps: 5, burst: 20, wantBurst: 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(tt.qps, tt.burst)
+			if (l == nil) != tt.wantNil {
+				t.Fatalf("New() = %v, wantNil %v", l, tt.wantNil)
+			}
+			if l != nil && l.Burst() != tt.wantBurst {
+				t.Errorf("New() burst = %d, want %d", l.Burst(), tt.wantBurst)
+			}
+		})
+	}
+}
+
+func TestWaiter_WrapTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// the cluster limiter allows everything; the global one allows one request and then one every 50ms
+	w := NewWaiter(New(1000, 0), nil, New(20, 1))
+	client := &http.Client{Transport: w.WrapTransport(http.DefaultTransport)}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		resp.Body.Close()
+	}
+	if got := w.Waited(); got < 80*time.Millisecond {
+		t.Errorf("Waited() = %v, want at least 80ms", got)
+	}
+}
+
+func TestWaiter_NoLimiters(t *testing.T) {
+	w := NewWaiter(nil, nil)
+	rt := http.DefaultTransport
+	if got := w.WrapTransport(rt); got != rt {
+		t.Errorf("WrapTransport() = %T, want the transport unwrapped", got)
+	}
+	if err := w.Wait(ctx.Background()); err != nil {
+		t.Errorf("Wait() error = %v", err)
+	}
+	if got := w.Waited(); got != 0 {
+		t.Errorf("Waited() = %v, want 0", got)
+	}
+}
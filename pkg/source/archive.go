@@ -0,0 +1,82 @@
+package source
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+// Archive reads a .tar.gz archive holding one top-level directory per context. The archive is read once, on first
+// use, and shared by all contexts.
+type Archive struct {
+	path string
+
+	once sync.Once
+	// context -> objects
+	objs map[string][]*unstructured.Unstructured
+	err  error
+}
+
+func NewArchive(path string) *Archive {
+	return &Archive{path: path}
+}
+
+// Source returns the Source for context. It is a Factory.
+func (a *Archive) Source(context string) (Source, error) {
+	a.once.Do(func() {
+		a.objs, a.err = readArchive(a.path)
+	})
+	if a.err != nil {
+		return nil, a.err
+	}
+	objs, ok := a.objs[context]
+	if !ok {
+		return nil, errors.Errorf("no directory for context %q in archive %q", context, a.path)
+	}
+	return &static{objs: objs}, nil
+}
+
+func readArchive(p string) (map[string][]*unstructured.Unstructured, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open archive")
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read gzip header")
+	}
+	defer gz.Close()
+	objs := map[string][]*unstructured.Unstructured{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read archive")
+		}
+		name := strings.TrimPrefix(path.Clean(hdr.Name), "./")
+		tokens := strings.SplitN(name, "/", 2)
+		if hdr.Typeflag != tar.TypeReg || len(tokens) != 2 ||
+			!util.ManifestExts[strings.ToLower(path.Ext(name))] {
+			continue
+		}
+		fileObjs, err := util.DecodeManifests(tr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %q from archive", hdr.Name)
+		}
+		objs[tokens[0]] = append(objs[tokens[0]], fileObjs...)
+	}
+	return objs, nil
+}
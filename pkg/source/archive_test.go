@@ -0,0 +1,81 @@
+package source
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	ctx "context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/mlowery/mcfetcher/pkg/config"
+)
+
+func writeArchive(t *testing.T, dir string, files map[string]string) string {
+	p := filepath.Join(dir, "dump.tar.gz")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mcfetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := writeArchive(t, dir, map[string]string{
+		"./c1/namespaces.json": `{"apiVersion":"v1","kind":"List","items":[
+			{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"a"}},
+			{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"b"}}]}`,
+		"c1/pods.yaml":       "apiVersion: v1\nkind: Pod\nmetadata:\n  name: p\n  namespace: a\n",
+		"c2/namespaces.yaml": "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: c\n",
+		"c2/README.txt":      "ignored",
+	})
+	a := NewArchive(p)
+	gvk := &config.GVK{Name: "namespace.", GroupVersionKind: schema.GroupVersionKind{Kind: "namespace"}}
+	for context, want := range map[string]int{"c1": 2, "c2": 1} {
+		src, err := a.Source(context)
+		if err != nil {
+			t.Fatalf("Source(%q) error = %v", context, err)
+		}
+		var got int
+		err = src.Each(ctx.Background(), gvk, func(*unstructured.Unstructured) error {
+			got++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Each() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("Each() for %q got %d objects, want %d", context, got, want)
+		}
+	}
+	if _, err := a.Source("c3"); err == nil {
+		t.Errorf("Source(%q) error = nil, want error", "c3")
+	}
+}
@@ -0,0 +1,27 @@
+package source
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+// NewDir returns a Source that reads every JSON/YAML file under <dir>/<context>.
+func NewDir(dir, context string) (Source, error) {
+	contextDir := filepath.Join(dir, context)
+	info, err := os.Stat(contextDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find directory for context %q", context)
+	}
+	if !info.IsDir() {
+		return nil, errors.Errorf("%q is not a directory", contextDir)
+	}
+	objs, err := util.ReadManifests(contextDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %q", contextDir)
+	}
+	return &static{objs: objs}, nil
+}
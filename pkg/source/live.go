@@ -0,0 +1,159 @@
+package source
+
+import (
+	ctx "context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/pager"
+	"k8s.io/client-go/transport"
+
+	dynamic2 "github.com/mlowery/mcfetcher/pkg/client/dynamic"
+	"github.com/mlowery/mcfetcher/pkg/config"
+	oerrors "github.com/mlowery/mcfetcher/pkg/errors"
+	"github.com/mlowery/mcfetcher/pkg/ratelimit"
+	"github.com/mlowery/mcfetcher/pkg/util"
+)
+
+// Live lists objects from a cluster.
+type Live struct {
+	context string
+	client  *dynamic2.Client
+	waiter  *ratelimit.Waiter
+	retries *retryCounter
+	logger  *zap.SugaredLogger
+}
+
+// NewLive returns a Source for the cluster named context (see LiveOptions.Clusters).
+func NewLive(context string, opts LiveOptions) (*Live, error) {
+	kubeContext, kubeconfig := context, opts.Kubeconfig
+	var clientSettings *config.ClientSettings
+	if c, ok := opts.Clusters[context]; ok {
+		kubeContext = c.Context
+		if len(c.Kubeconfig) > 0 {
+			kubeconfig = c.Kubeconfig
+		}
+		clientSettings = c.Client
+	}
+	restConfig, err := dynamic2.ClientConfig(kubeContext, kubeconfig).ClientConfig()
+	if err != nil {
+		return nil, oerrors.New(err, "failed to get rest config", "context", context)
+	}
+	if err := dynamic2.ApplySettings(restConfig, clientSettings); err != nil {
+		return nil, oerrors.New(err, "failed to apply client settings", "context", context)
+	}
+	var clusterLimiter *rate.Limiter
+	if clientSettings != nil {
+		clusterLimiter = ratelimit.New(clientSettings.RateLimitQPS, clientSettings.RateLimitBurst)
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = zap.NewNop().Sugar()
+	}
+	logger = logger.Named(util.ComponentClient).With("context", context)
+	// wrapped before any client is built so that discovery is limited too
+	waiter := ratelimit.NewWaiter(clusterLimiter, opts.GlobalLimiter)
+	retries := newRetryCounter(context, logger)
+	restConfig.WrapTransport = transport.Wrappers(restConfig.WrapTransport, waiter.WrapTransport,
+		retries.WrapTransport)
+	client, err := dynamic2.New(restConfig)
+	if err != nil {
+		return nil, oerrors.New(err, "failed to create client (is proxy configured correctly?)", "context", context)
+	}
+	return &Live{
+		context: context,
+		client:  client,
+		waiter:  waiter,
+		retries: retries,
+		logger:  logger,
+	}, nil
+}
+
+func (l *Live) Each(c ctx.Context, gvk *config.GVK, fn func(*unstructured.Unstructured) error) error {
+	logger := l.logger.With("gvk", gvk.Name)
+	var pages int
+	// use pager to avoid: Stream error http2.StreamError{StreamID:0x5, Code:0x2, Cause:error(nil)} when
+	// reading response body, may be caused by closed connection. Please retry.
+	list := func(opts metav1.ListOptions) (runtime.Object, error) {
+		if gvk.MetadataOnly {
+			return l.listMetadata(gvk, opts)
+		}
+		r, err := l.client.GetResourceInterface(gvk.GroupVersionKind, gvk.Versions, metav1.NamespaceAll)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get resource interface")
+		}
+		return r.List(opts)
+	}
+	objPager := pager.New(pager.SimplePageFunc(countPages(c, &pages, list)))
+	// an error here is returned by the list itself
+	if gvr, err := l.client.Resource(gvk.GroupVersionKind, gvk.Versions); err == nil {
+		defer l.retries.track(gvr, gvk.Name)()
+	}
+	var items int
+	err := objPager.EachListItem(c, metav1.ListOptions{}, func(obj runtime.Object) error {
+		items++
+		return fn(obj.(*unstructured.Unstructured))
+	})
+	logger.Debugw("listed pages", "pages", pages, "items", items, "metadataOnly", gvk.MetadataOnly)
+	return err
+}
+
+// listFunc lists one page.
+type listFunc func(opts metav1.ListOptions) (runtime.Object, error)
+
+// countPages wraps list so that pages counts the pages listed successfully. It calls onPage after each of them.
+func countPages(c ctx.Context, pages *int, list listFunc) listFunc {
+	return func(opts metav1.ListOptions) (runtime.Object, error) {
+		obj, err := list(opts)
+		if err != nil {
+			return nil, err
+		}
+		*pages++
+		onPage(c, *pages)
+		return obj, nil
+	}
+}
+
+// listMetadata lists one page of object metadata and returns it as an *unstructured.UnstructuredList so that it
+// sanitizes the same as a full list.
+func (l *Live) listMetadata(gvk *config.GVK, opts metav1.ListOptions) (runtime.Object, error) {
+	r, servedGVK, err := l.client.GetMetadataResourceInterface(gvk.GroupVersionKind, gvk.Versions,
+		metav1.NamespaceAll)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get metadata resource interface")
+	}
+	partialList, err := r.List(opts)
+	if err != nil {
+		return nil, err
+	}
+	list := &unstructured.UnstructuredList{Object: map[string]interface{}{}}
+	list.SetResourceVersion(partialList.GetResourceVersion())
+	list.SetContinue(partialList.GetContinue())
+	for i := range partialList.Items {
+		m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&partialList.Items[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to convert metadata")
+		}
+		obj := unstructured.Unstructured{Object: m}
+		obj.SetGroupVersionKind(servedGVK)
+		list.Items = append(list.Items, obj)
+	}
+	return list, nil
+}
+
+func (l *Live) ServedVersion(gvk *config.GVK) (string, error) {
+	gvr, err := l.client.Resource(gvk.GroupVersionKind, gvk.Versions)
+	if err != nil {
+		return "", err
+	}
+	return gvr.Version, nil
+}
+
+func (l *Live) Waited() time.Duration {
+	return l.waiter.Waited()
+}
@@ -0,0 +1,44 @@
+package source
+
+import (
+	ctx "context"
+	"errors"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func Test_countPages(t *testing.T) {
+	var seen []int
+	c := WithOnPage(ctx.Background(), func(pages int) {
+		seen = append(seen, pages)
+	})
+	fail := true
+	var pages int
+	list := countPages(c, &pages, func(opts metav1.ListOptions) (runtime.Object, error) {
+		// every other call fails
+		fail = !fail
+		if fail {
+			return nil, errors.New("stream error")
+		}
+		return &unstructured.UnstructuredList{}, nil
+	})
+	for i := 0; i < 4; i++ {
+		obj, err := list(metav1.ListOptions{})
+		if (err != nil) != (i%2 == 1) {
+			t.Fatalf("call %d: error = %v", i, err)
+		}
+		if err != nil && obj != nil {
+			t.Errorf("call %d: got %v with an error", i, obj)
+		}
+	}
+	if pages != 2 {
+		t.Errorf("pages = %d, want 2", pages)
+	}
+	if want := []int{1, 2}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("onPage called with %v, want %v", seen, want)
+	}
+}
@@ -0,0 +1,91 @@
+package source
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+
+	"github.com/mlowery/mcfetcher/pkg/metrics"
+)
+
+// retryCounter counts the list requests that client-go retries on its own: GETs that failed with a connection reset
+// and responses that ask to be retried after a delay (see checkWait in k8s.io/client-go/rest). Only requests for lists
+// in progress (see track) are counted since the metric is labelled by GVK.
+type retryCounter struct {
+	context string
+	logger  *zap.SugaredLogger
+
+	mu sync.Mutex
+	// gvks maps the paths of lists in progress to their GVK keys
+	gvks map[string]string
+}
+
+func newRetryCounter(context string, logger *zap.SugaredLogger) *retryCounter {
+	return &retryCounter{context: context, logger: logger, gvks: map[string]string{}}
+}
+
+// track counts retries of requests for all objects of gvr as retries of gvkString until the returned func is called.
+func (c *retryCounter) track(gvr schema.GroupVersionResource, gvkString string) func() {
+	path := listPath(gvr)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gvks[path] = gvkString
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.gvks, path)
+	}
+}
+
+// listPath returns the URL path of a list of gvr across all namespaces.
+func listPath(gvr schema.GroupVersionResource) string {
+	if len(gvr.Group) == 0 {
+		return "/api/" + gvr.Version + "/" + gvr.Resource
+	}
+	return "/apis/" + gvr.Group + "/" + gvr.Version + "/" + gvr.Resource
+}
+
+// WrapTransport counts the retries of requests through rt. It can be used as rest.Config.WrapTransport.
+func (c *retryCounter) WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	return &retryRoundTripper{counter: c, rt: rt}
+}
+
+type retryRoundTripper struct {
+	counter *retryCounter
+	rt      http.RoundTripper
+}
+
+func (r *retryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.rt.RoundTrip(req)
+	if willRetry(req, resp, err) {
+		r.counter.mu.Lock()
+		gvkString, ok := r.counter.gvks[req.URL.Path]
+		r.counter.mu.Unlock()
+		if ok {
+			metrics.Retries.WithLabelValues(r.counter.context, gvkString).Inc()
+			r.counter.logger.Warnw("retrying list", "gvk", gvkString)
+		}
+	}
+	return resp, err
+}
+
+// WrappedRoundTripper lets client-go find the transport underneath.
+func (r *retryRoundTripper) WrappedRoundTripper() http.RoundTripper {
+	return r.rt
+}
+
+// willRetry returns true if client-go retries a request that got resp or err.
+func willRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return req.Method == http.MethodGet && utilnet.IsConnectionReset(err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return false
+	}
+	_, err = strconv.Atoi(resp.Header.Get("Retry-After"))
+	return err == nil
+}
@@ -0,0 +1,97 @@
+package source
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/mlowery/mcfetcher/pkg/metrics"
+)
+
+func Test_willRetry(t *testing.T) {
+	get := httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+	post := httptest.NewRequest(http.MethodPost, "/api/v1/pods", nil)
+	response := func(status int, retryAfter string) *http.Response {
+		resp := &http.Response{StatusCode: status, Header: http.Header{}}
+		if len(retryAfter) > 0 {
+			resp.Header.Set("Retry-After", retryAfter)
+		}
+		return resp
+	}
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}
+	tests := []struct {
+		name string
+		req  *http.Request
+		resp *http.Response
+		err  error
+		want bool
+	}{
+		{name: "ok", req: get, resp: response(http.StatusOK, ""), want: false},
+		{name: "too many requests", req: get, resp: response(http.StatusTooManyRequests, "1"), want: true},
+		{name: "unavailable", req: get, resp: response(http.StatusServiceUnavailable, "0"), want: true},
+		{name: "without retry-after", req: get, resp: response(http.StatusServiceUnavailable, ""), want: false},
+		{name: "retry-after date", req: get, resp: response(http.StatusTooManyRequests, "Wed, 21 Oct 2015 07:28:00 GMT"),
+			want: false},
+		{name: "not found", req: get, resp: response(http.StatusNotFound, "1"), want: false},
+		{name: "connection reset", req: get, err: reset, want: true},
+		{name: "connection reset of a write", req: post, err: reset, want: false},
+		{name: "other error", req: get, err: errors.New("no route to host"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := willRetry(tt.req, tt.resp, tt.err); got != tt.want {
+				t.Errorf("willRetry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRetryCounter(t *testing.T) {
+	counter := newRetryCounter("retry-test", zap.NewNop().Sugar())
+	rt := counter.WrapTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"1"}}}, nil
+	}))
+	retries := func(gvkString string) float64 {
+		return testutil.ToFloat64(metrics.Retries.WithLabelValues("retry-test", gvkString))
+	}
+	roundTrip := func(path string) {
+		if _, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, path, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	untrack := counter.track(schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+		"deployment.apps")
+	roundTrip("/apis/apps/v1/deployments")
+	// discovery and other lists aren't counted
+	roundTrip("/apis/apps/v1")
+	roundTrip("/api/v1/pods")
+	if got := retries("deployment.apps"); got != 1 {
+		t.Errorf("retries of deployment.apps = %v, want 1", got)
+	}
+
+	untrack()
+	defer counter.track(schema.GroupVersionResource{Version: "v1", Resource: "pods"}, "pod.")()
+	roundTrip("/apis/apps/v1/deployments")
+	roundTrip("/api/v1/pods")
+	if got := retries("deployment.apps"); got != 1 {
+		t.Errorf("retries of deployment.apps after it is done = %v, want 1", got)
+	}
+	if got := retries("pod."); got != 1 {
+		t.Errorf("retries of pod. = %v, want 1", got)
+	}
+}
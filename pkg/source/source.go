@@ -0,0 +1,116 @@
+package source
+
+import (
+	ctx "context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/mlowery/mcfetcher/pkg/config"
+)
+
+const (
+	kindLive    = "live"
+	kindDir     = "dir"
+	kindArchive = "archive"
+)
+
+// Source lists the objects of one context.
+type Source interface {
+	// Each calls fn with every object selected by gvk before sanitizing. If fn returns an error, listing stops and
+	// the error is returned. Objects are passed as they arrive so callers should not hold on to them longer than
+	// needed.
+	Each(c ctx.Context, gvk *config.GVK, fn func(*unstructured.Unstructured) error) error
+}
+
+// Waiter is implemented by sources that can be rate limited.
+type Waiter interface {
+	// Waited returns the total time requests have been held back by rate limits so far.
+	Waited() time.Duration
+}
+
+// VersionResolver is implemented by sources that can tell which version of a GVK they list, even if there are no
+// objects.
+type VersionResolver interface {
+	ServedVersion(gvk *config.GVK) (string, error)
+}
+
+type onPageKey struct{}
+
+// WithOnPage returns a copy of c that makes Each call fn with the number of pages listed so far after each page.
+// fn may be called from a different goroutine than the one calling Each. Sources that don't page call it once.
+func WithOnPage(c ctx.Context, fn func(pages int)) ctx.Context {
+	return ctx.WithValue(c, onPageKey{}, fn)
+}
+
+// onPage calls the func set by WithOnPage, if any.
+func onPage(c ctx.Context, pages int) {
+	if fn, ok := c.Value(onPageKey{}).(func(int)); ok {
+		fn(pages)
+	}
+}
+
+// Factory returns the Source for a context.
+type Factory func(context string) (Source, error)
+
+// LiveOptions configure live sources.
+type LiveOptions struct {
+	Kubeconfig string
+	// Clusters are looked up by the name passed to the Factory. Names that aren't in it are contexts in Kubeconfig.
+	Clusters map[string]*config.Cluster
+	// GlobalLimiter, if set, is shared by every cluster in addition to each cluster's own limit.
+	GlobalLimiter *rate.Limiter
+	Logger        *zap.SugaredLogger
+}
+
+// NewFactory parses spec, which is one of:
+//
+//	live                 list from the cluster of each kubeconfig context (the default)
+//	dir:<path>           read JSON/YAML files (e.g. kubectl get -o json dumps) from <path>/<context>/
+//	archive:<path>       read JSON/YAML files under <context>/ in a .tar.gz archive
+func NewFactory(spec string, liveOpts LiveOptions) (Factory, error) {
+	tokens := strings.SplitN(spec, ":", 2)
+	switch tokens[0] {
+	case "", kindLive:
+		return func(context string) (Source, error) {
+			return NewLive(context, liveOpts)
+		}, nil
+	case kindDir:
+		if len(tokens) != 2 || len(tokens[1]) == 0 {
+			return nil, errors.Errorf("expected dir:<path> in %q", spec)
+		}
+		return func(context string) (Source, error) {
+			return NewDir(tokens[1], context)
+		}, nil
+	case kindArchive:
+		if len(tokens) != 2 || len(tokens[1]) == 0 {
+			return nil, errors.Errorf("expected archive:<path> in %q", spec)
+		}
+		a := NewArchive(tokens[1])
+		return a.Source, nil
+	default:
+		return nil, errors.Errorf("unknown source %q", spec)
+	}
+}
+
+// static is a Source backed by objects already in memory.
+type static struct {
+	objs []*unstructured.Unstructured
+}
+
+func (s *static) Each(c ctx.Context, gvk *config.GVK, fn func(*unstructured.Unstructured) error) error {
+	for _, obj := range s.objs {
+		if !gvk.Matches(obj.GroupVersionKind()) {
+			continue
+		}
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+	onPage(c, 1)
+	return nil
+}
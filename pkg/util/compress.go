@@ -0,0 +1,110 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// Compression is how raw object files are compressed.
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// Compressions are all supported compressions.
+var Compressions = []Compression{CompressionNone, CompressionGzip, CompressionZstd}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ParseCompression parses s, which is empty (no compression) or one of Compressions.
+func ParseCompression(s string) (Compression, error) {
+	if len(s) == 0 {
+		return CompressionNone, nil
+	}
+	for _, c := range Compressions {
+		if Compression(s) == c {
+			return c, nil
+		}
+	}
+	return "", errors.Errorf("unknown compression %q (expected one of %v)", s, Compressions)
+}
+
+// Ext returns the extension appended to file names, including the leading dot.
+func (c Compression) Ext() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// CompressionForPath returns the compression implied by the extension of path.
+func CompressionForPath(path string) Compression {
+	for _, c := range Compressions {
+		if len(c.Ext()) > 0 && strings.HasSuffix(path, c.Ext()) {
+			return c
+		}
+	}
+	return CompressionNone
+}
+
+// NewCompressWriter returns a writer that compresses to w with c. Close must be called to flush it; it doesn't close
+// w.
+func NewCompressWriter(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+// NewDecompressReader returns a reader that decompresses r. The compression is detected from magic bytes so
+// uncompressed files read as is.
+func NewDecompressReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	// a short (or empty) file just can't be compressed
+	head, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read gzip header")
+		}
+		return gr, nil
+	case bytes.HasPrefix(head, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read zstd header")
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return ioutil.NopCloser(br), nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
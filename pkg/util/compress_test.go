@@ -0,0 +1,60 @@
+package util
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestWriteReadRawObjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mcfetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	obj := newObj("a", "b", map[string]interface{}{"replicas": int64(3)})
+	obj.SetAPIVersion("apps/v1")
+	obj.SetKind("Deployment")
+	objs := []*unstructured.Unstructured{obj}
+	tests := []struct {
+		name      string
+		filename  string
+		wantMagic []byte
+	}{
+		{"none", "c1.json", []byte("[")},
+		{"gzip", "c1.json.gz", gzipMagic},
+		{"zstd", "c1.json.zst", zstdMagic},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := filepath.Join(dir, tt.filename)
+			if err := WriteRawObjects(p, objs); err != nil {
+				t.Fatalf("WriteRawObjects() error = %v", err)
+			}
+			b, err := ioutil.ReadFile(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(b, tt.wantMagic) {
+				t.Errorf("WriteRawObjects() wrote %x..., want prefix %x", b[:4], tt.wantMagic)
+			}
+			// detected by magic bytes regardless of the name
+			renamed := filepath.Join(dir, "renamed")
+			if err := os.Rename(p, renamed); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadRawObjects(renamed)
+			if err != nil {
+				t.Fatalf("ReadRawObjects() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, objs) {
+				t.Errorf("ReadRawObjects() = %v, want %v", got, objs)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package util
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ObjectsDiff is the result of comparing two sets of objects keyed by namespace/name.
+type ObjectsDiff struct {
+	// Missing holds keys present in want but not in got.
+	Missing []string
+	// Extra holds keys present in got but not in want.
+	Extra []string
+	// Differing maps keys present in both to the paths whose values differ. Objects in different API versions are
+	// only compared at the paths both of them have (see DiffSharedPaths).
+	Differing map[string][]string
+	// VersionMismatch maps keys present in both but in different API versions to the two versions.
+	VersionMismatch map[string]*VersionMismatch
+}
+
+// VersionMismatch is a pair of API versions of the same object.
+type VersionMismatch struct {
+	Want string
+	Got  string
+}
+
+// Empty returns true if there are no differences.
+func (d *ObjectsDiff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Differing) == 0 && len(d.VersionMismatch) == 0
+}
+
+// DiffObjects compares want against got. Objects are matched by namespace/name.
+func DiffObjects(want, got []*unstructured.Unstructured) *ObjectsDiff {
+	wantByKey := objectsByKey(want)
+	gotByKey := objectsByKey(got)
+	d := &ObjectsDiff{
+		Differing:       map[string][]string{},
+		VersionMismatch: map[string]*VersionMismatch{},
+	}
+	for key, wantObj := range wantByKey {
+		gotObj, ok := gotByKey[key]
+		if !ok {
+			d.Missing = append(d.Missing, key)
+			continue
+		}
+		diff := DiffPaths
+		if wantObj.GetAPIVersion() != gotObj.GetAPIVersion() {
+			d.VersionMismatch[key] = &VersionMismatch{Want: wantObj.GetAPIVersion(), Got: gotObj.GetAPIVersion()}
+			diff = DiffSharedPaths
+		}
+		if paths := diff(wantObj.Object, gotObj.Object); len(paths) > 0 {
+			d.Differing[key] = paths
+		}
+	}
+	for key := range gotByKey {
+		if _, ok := wantByKey[key]; !ok {
+			d.Extra = append(d.Extra, key)
+		}
+	}
+	sort.Strings(d.Missing)
+	sort.Strings(d.Extra)
+	return d
+}
+
+// DiffPaths returns the sorted paths (in the same /-separated form as keep-paths) at which a and b differ.
+func DiffPaths(a, b map[string]interface{}) []string {
+	var paths []string
+	diffValues("", a, b, false, &paths)
+	sort.Strings(paths)
+	return paths
+}
+
+// DiffSharedPaths is like DiffPaths but skips paths that only one of a and b has, as well as /apiVersion. It compares
+// the same object in two API versions, where fields added, removed, or moved between the versions say nothing about
+// the object.
+func DiffSharedPaths(a, b map[string]interface{}) []string {
+	var paths []string
+	diffValues("", a, b, true, &paths)
+	sort.Strings(paths)
+	return paths
+}
+
+func diffValues(path string, a, b interface{}, sharedOnly bool, paths *[]string) {
+	aMap, aIsMap := a.(map[string]interface{})
+	bMap, bIsMap := b.(map[string]interface{})
+	if aIsMap && bIsMap {
+		for k, av := range aMap {
+			childPath := fmt.Sprintf("%s/%s", path, k)
+			bv, ok := bMap[k]
+			if sharedOnly && (!ok || childPath == "/apiVersion") {
+				continue
+			}
+			diffValues(childPath, av, bv, sharedOnly, paths)
+		}
+		if sharedOnly {
+			return
+		}
+		for k, bv := range bMap {
+			if _, ok := aMap[k]; !ok {
+				diffValues(fmt.Sprintf("%s/%s", path, k), nil, bv, sharedOnly, paths)
+			}
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		if len(path) == 0 {
+			path = "/"
+		}
+		*paths = append(*paths, path)
+	}
+}
+
+func objectsByKey(objs []*unstructured.Unstructured) map[string]*unstructured.Unstructured {
+	m := make(map[string]*unstructured.Unstructured, len(objs))
+	for _, obj := range objs {
+		m[ObjectKey(obj)] = obj
+	}
+	return m
+}
@@ -0,0 +1,125 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newObj(namespace, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	if spec != nil {
+		obj.Object["spec"] = spec
+	}
+	return obj
+}
+
+func TestDiffObjects(t *testing.T) {
+	tests := []struct {
+		name          string
+		want          []*unstructured.Unstructured
+		got           []*unstructured.Unstructured
+		wantMissing   []string
+		wantExtra     []string
+		wantDiffering map[string][]string
+	}{
+		{
+			"equal",
+			[]*unstructured.Unstructured{newObj("ns", "a", map[string]interface{}{"replicas": int64(1)})},
+			[]*unstructured.Unstructured{newObj("ns", "a", map[string]interface{}{"replicas": int64(1)})},
+			nil,
+			nil,
+			map[string][]string{},
+		},
+		{
+			"missing and extra",
+			[]*unstructured.Unstructured{newObj("", "a", nil)},
+			[]*unstructured.Unstructured{newObj("", "b", nil)},
+			[]string{"a"},
+			[]string{"b"},
+			map[string][]string{},
+		},
+		{
+			"differing",
+			[]*unstructured.Unstructured{newObj("ns", "a", map[string]interface{}{"replicas": int64(1), "paused": true})},
+			[]*unstructured.Unstructured{newObj("ns", "a", map[string]interface{}{"replicas": int64(2), "foo": "bar"})},
+			nil,
+			nil,
+			map[string][]string{"ns/a": {"/spec/foo", "/spec/paused", "/spec/replicas"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := DiffObjects(tt.want, tt.got)
+			if !reflect.DeepEqual(d.Missing, tt.wantMissing) {
+				t.Errorf("DiffObjects() Missing = %v, want %v", d.Missing, tt.wantMissing)
+			}
+			if !reflect.DeepEqual(d.Extra, tt.wantExtra) {
+				t.Errorf("DiffObjects() Extra = %v, want %v", d.Extra, tt.wantExtra)
+			}
+			if !reflect.DeepEqual(d.Differing, tt.wantDiffering) {
+				t.Errorf("DiffObjects() Differing = %v, want %v", d.Differing, tt.wantDiffering)
+			}
+		})
+	}
+}
+
+func TestDiffObjects_VersionMismatch(t *testing.T) {
+	newVersioned := func(name, apiVersion string, spec map[string]interface{}) *unstructured.Unstructured {
+		obj := newObj("ns", name, spec)
+		obj.SetAPIVersion(apiVersion)
+		return obj
+	}
+	want := []*unstructured.Unstructured{
+		newVersioned("a", "apps/v1", map[string]interface{}{"replicas": int64(1)}),
+		newVersioned("b", "apps/v1", map[string]interface{}{"replicas": int64(1), "paused": true}),
+	}
+	got := []*unstructured.Unstructured{
+		// only in extensions/v1beta1
+		newVersioned("a", "extensions/v1beta1", map[string]interface{}{"replicas": int64(1),
+			"templateGeneration": int64(3)}),
+		newVersioned("b", "extensions/v1beta1", map[string]interface{}{"replicas": int64(2)}),
+	}
+	d := DiffObjects(want, got)
+	wantMismatch := map[string]*VersionMismatch{
+		"ns/a": {Want: "apps/v1", Got: "extensions/v1beta1"},
+		"ns/b": {Want: "apps/v1", Got: "extensions/v1beta1"},
+	}
+	if !reflect.DeepEqual(d.VersionMismatch, wantMismatch) {
+		t.Errorf("DiffObjects() VersionMismatch = %v, want %v", d.VersionMismatch, wantMismatch)
+	}
+	wantDiffering := map[string][]string{"ns/b": {"/spec/replicas"}}
+	if !reflect.DeepEqual(d.Differing, wantDiffering) {
+		t.Errorf("DiffObjects() Differing = %v, want %v", d.Differing, wantDiffering)
+	}
+}
+
+func TestDiffSharedPaths(t *testing.T) {
+	a := map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"spec": map[string]interface{}{
+			"same":     "x",
+			"changed":  "x",
+			"onlyA":    "x",
+			"typeDiff": map[string]interface{}{"k": "v"},
+			"nullA":    nil,
+		},
+	}
+	b := map[string]interface{}{
+		"apiVersion": "extensions/v1beta1",
+		"spec": map[string]interface{}{
+			"same":     "x",
+			"changed":  "y",
+			"onlyB":    "x",
+			"typeDiff": "v",
+			"nullA":    "x",
+		},
+	}
+	want := []string{"/spec/changed", "/spec/nullA", "/spec/typeDiff"}
+	if got := DiffSharedPaths(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffSharedPaths() = %v, want %v", got, want)
+	}
+}
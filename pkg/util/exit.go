@@ -0,0 +1,40 @@
+package util
+
+import "fmt"
+
+// Exit codes of every command, so that scripts can tell what went wrong.
+const (
+	ExitOK = 0
+	// ExitFailure means nothing succeeded or something unexpected went wrong.
+	ExitFailure = 1
+	// ExitConfigError means the config, flags, or arguments are invalid. Nothing was attempted.
+	ExitConfigError = 2
+	// ExitPartialFailure means some work failed and the rest succeeded.
+	ExitPartialFailure = 3
+	// ExitDrift means a comparison found differences (and nothing failed).
+	ExitDrift = 4
+)
+
+// ConfigError is what the config readers (e.g. config.ReadGVKOrDie) panic with when the config is invalid. The root
+// command reports it and exits with ExitConfigError. Any other panic is a bug.
+type ConfigError struct {
+	err error
+}
+
+// NewConfigError returns a *ConfigError for err.
+func NewConfigError(err error) *ConfigError {
+	return &ConfigError{err: err}
+}
+
+// ConfigErrorf returns a *ConfigError with a formatted message.
+func ConfigErrorf(format string, args ...interface{}) *ConfigError {
+	return &ConfigError{err: fmt.Errorf(format, args...)}
+}
+
+func (e *ConfigError) Error() string {
+	return e.err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,53 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// lockFile is the file under a work dir that runs lock.
+const lockFile = ".mcfetcher.lock"
+
+// ErrLocked is returned by LockWorkDir when another run holds the lock.
+var ErrLocked = errors.New("work dir is locked")
+
+// LockWorkDir takes an advisory lock on dir so that concurrent runs don't clobber each other's cache files. It
+// doesn't wait; if another run holds the lock, the returned error wraps ErrLocked and names that run's pid. The
+// lock is released by calling the returned func or when the process exits.
+func LockWorkDir(dir string) (func(), error) {
+	p := filepath.Join(dir, lockFile)
+	file, err := os.OpenFile(p, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open lock file")
+	}
+	locked, err := tryLock(file)
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "failed to lock %q", p)
+	}
+	if !locked {
+		file.Close()
+		holder := "another run"
+		if b, err := ioutil.ReadFile(p); err == nil {
+			if pid, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil {
+				holder = fmt.Sprintf("another run (pid %d)", pid)
+			}
+		}
+		return nil, errors.Wrapf(ErrLocked, "%s is using %q; wait for it to finish or use a different --work-dir",
+			holder, dir)
+	}
+	// the pid is only informational so failing to record it is not an error
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return func() {
+		unlock(file)
+		file.Close()
+	}, nil
+}
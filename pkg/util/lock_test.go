@@ -0,0 +1,30 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestLockWorkDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mcfetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	unlock, err := LockWorkDir(dir)
+	if err != nil {
+		t.Fatalf("LockWorkDir() error = %v", err)
+	}
+	if _, err := LockWorkDir(dir); errors.Cause(err) != ErrLocked {
+		t.Errorf("LockWorkDir() while locked error = %v, want %v", err, ErrLocked)
+	}
+	unlock()
+	unlock, err = LockWorkDir(dir)
+	if err != nil {
+		t.Fatalf("LockWorkDir() after unlock error = %v", err)
+	}
+	unlock()
+}
@@ -0,0 +1,174 @@
+package util
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Components are logger names (see zap.Logger.Named) whose level can be set apart from log-level with
+// log-level-<component>.
+const (
+	// ComponentClient is the Kubernetes client: discovery, lists, and retries.
+	ComponentClient = "client"
+	// ComponentSanitize is the filtering and sanitizing of objects.
+	ComponentSanitize = "sanitize"
+	// ComponentCache is the reading and writing of cached results.
+	ComponentCache = "cache"
+)
+
+var components = []string{ComponentClient, ComponentSanitize, ComponentCache}
+
+// NewLogger returns a *zap.SugaredLogger and a func that should be called with defer. It is configured by log-level,
+// log-format (json or console), log-file, and log-level-<component>. Without log-file, warnings and above go to stderr
+// and everything else goes to stdout. It panics on invalid settings.
+func NewLogger() (*zap.SugaredLogger, func()) {
+	return newLogger(true)
+}
+
+// NewStderrLogger is like NewLogger but without log-file every level goes to stderr. It is for commands that write
+// their output to stdout.
+func NewStderrLogger() (*zap.SugaredLogger, func()) {
+	return newLogger(false)
+}
+
+func newLogger(stdout bool) (*zap.SugaredLogger, func()) {
+	encoder := newEncoderOrDie()
+
+	// levels are checked by componentCore so the cores below only split by destination
+	var core zapcore.Core
+	var file *os.File
+	if path := viper.GetString("log-file"); len(path) > 0 {
+		var err error
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			panic(ConfigErrorf("failed to open log-file: %v", err))
+		}
+		core = zapcore.NewCore(encoder, zapcore.Lock(file), zap.DebugLevel)
+	} else if !stdout {
+		core = zapcore.NewCore(encoder, zapcore.Lock(os.Stderr), zap.DebugLevel)
+	} else {
+		highPriority := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
+			return lvl >= zapcore.WarnLevel
+		})
+		lowPriority := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
+			return lvl < zapcore.WarnLevel
+		})
+		core = zapcore.NewTee(
+			zapcore.NewCore(encoder, zapcore.Lock(os.Stderr), highPriority),
+			zapcore.NewCore(encoder, zapcore.Lock(os.Stdout), lowPriority),
+		)
+	}
+	l := zap.New(newComponentCoreOrDie(core))
+
+	logger := l.Sugar()
+	f := func() {
+		logger.Sync()
+		if file != nil {
+			file.Close()
+		}
+	}
+	return logger, f
+}
+
+// NewLoggerTo returns a logger configured like NewLogger's that writes entries at or above minLevel to w.
+func NewLoggerTo(w io.Writer, minLevel zapcore.Level) *zap.SugaredLogger {
+	core := zapcore.NewCore(newEncoderOrDie(), zapcore.Lock(zapcore.AddSync(w)), minLevel)
+	return zap.New(newComponentCoreOrDie(core)).Sugar()
+}
+
+func newEncoderOrDie() zapcore.Encoder {
+	// copy and paste of zap.NewExample with parts from zap_test.Example_advancedConfiguration
+	encoderCfg := zapcore.EncoderConfig{
+		MessageKey:     "msg",
+		LevelKey:       "level",
+		NameKey:        "logger",
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+	}
+	switch format := viper.GetString("log-format"); format {
+	case "", "json":
+		return zapcore.NewJSONEncoder(encoderCfg)
+	case "console":
+		encoderCfg.EncodeLevel = zapcore.CapitalLevelEncoder
+		return zapcore.NewConsoleEncoder(encoderCfg)
+	default:
+		panic(ConfigErrorf("invalid log-format %q: must be json or console", format))
+	}
+}
+
+// newComponentCoreOrDie wraps core in a componentCore with the levels of log-level and log-level-<component>.
+func newComponentCoreOrDie(core zapcore.Core) *componentCore {
+	level := parseLevelOrDie("log-level", viper.GetString("log-level"))
+	levels := map[string]zapcore.Level{}
+	for _, component := range components {
+		key := "log-level-" + component
+		if raw := viper.GetString(key); len(raw) > 0 {
+			levels[component] = parseLevelOrDie(key, raw)
+		}
+	}
+	return newComponentCore(core, level, levels)
+}
+
+func parseLevelOrDie(key, raw string) zapcore.Level {
+	if len(raw) == 0 {
+		return zapcore.InfoLevel
+	}
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(raw)); err != nil {
+		panic(ConfigErrorf("invalid %s %q: must be debug, info, warn, or error", key, raw))
+	}
+	return level
+}
+
+// componentCore drops entries below the level of the component that logged them or below the default level for
+// entries outside any component.
+type componentCore struct {
+	zapcore.Core
+	level  zapcore.Level
+	levels map[string]zapcore.Level
+	// min is the lowest of all levels
+	min zapcore.Level
+}
+
+func newComponentCore(core zapcore.Core, level zapcore.Level, levels map[string]zapcore.Level) *componentCore {
+	min := level
+	for _, l := range levels {
+		if l < min {
+			min = l
+		}
+	}
+	return &componentCore{Core: core, level: level, levels: levels, min: min}
+}
+
+func (c *componentCore) Enabled(lvl zapcore.Level) bool {
+	return lvl >= c.min && c.Core.Enabled(lvl)
+}
+
+func (c *componentCore) With(fields []zapcore.Field) zapcore.Core {
+	return &componentCore{Core: c.Core.With(fields), level: c.level, levels: c.levels, min: c.min}
+}
+
+func (c *componentCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level < c.levelFor(ent.LoggerName) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// levelFor returns the level of the innermost component in name (e.g. sanitize in client.sanitize) or the default
+// level.
+func (c *componentCore) levelFor(name string) zapcore.Level {
+	parts := strings.Split(name, ".")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if level, ok := c.levels[parts[i]]; ok {
+			return level
+		}
+	}
+	return c.level
+}
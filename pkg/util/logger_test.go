@@ -0,0 +1,65 @@
+package util
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestComponentCore(t *testing.T) {
+	inner, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(newComponentCore(inner, zapcore.InfoLevel, map[string]zapcore.Level{
+		ComponentSanitize: zapcore.DebugLevel,
+		ComponentCache:    zapcore.ErrorLevel,
+	})).Sugar()
+
+	logger.Debug("default debug")
+	logger.Info("default info")
+	logger.Named(ComponentSanitize).Debug("sanitize debug")
+	logger.Named(ComponentCache).Warn("cache warn")
+	logger.Named(ComponentCache).Error("cache error")
+	logger.Named(ComponentClient).Named(ComponentSanitize).With("k", "v").Debug("nested sanitize debug")
+	logger.Named(ComponentClient).Debug("client debug")
+
+	var got []string
+	for _, entry := range logs.All() {
+		got = append(got, entry.Message)
+	}
+	want := []string{"default info", "sanitize debug", "cache error", "nested sanitize debug"}
+	if len(got) != len(want) {
+		t.Fatalf("logged %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("logged %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func Test_parseLevelOrDie(t *testing.T) {
+	tests := []struct {
+		raw       string
+		want      zapcore.Level
+		wantPanic bool
+	}{
+		{raw: "", want: zapcore.InfoLevel},
+		{raw: "debug", want: zapcore.DebugLevel},
+		{raw: "WARN", want: zapcore.WarnLevel},
+		{raw: "loud", wantPanic: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			defer func() {
+				if r := recover(); (r != nil) != tt.wantPanic {
+					t.Errorf("parseLevelOrDie() panic = %v, wantPanic %v", r, tt.wantPanic)
+				}
+			}()
+			if got := parseLevelOrDie("log-level", tt.raw); got != tt.want {
+				t.Errorf("parseLevelOrDie() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
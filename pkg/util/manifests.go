@@ -0,0 +1,92 @@
+package util
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// ManifestExts are the file extensions (lowercase) of files that DecodeManifests understands.
+var ManifestExts = map[string]bool{
+	".yaml": true,
+	".yml":  true,
+	".json": true,
+}
+
+// ReadManifests walks dir and returns every object found in YAML or JSON files. Multi-document files and List
+// kinds are flattened into individual objects.
+func ReadManifests(dir string) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !ManifestExts[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		fileObjs, err := readManifestFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read manifest %q", path)
+		}
+		objs = append(objs, fileObjs...)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to walk manifests")
+	}
+	return objs, nil
+}
+
+func readManifestFile(path string) ([]*unstructured.Unstructured, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open file")
+	}
+	defer file.Close()
+	return DecodeManifests(file)
+}
+
+// DecodeManifests returns every object in r, which holds one or more YAML or JSON documents. List kinds are
+// flattened into individual objects.
+func DecodeManifests(r io.Reader) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+	decoder := yaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode")
+		}
+		if len(raw) == 0 || string(raw) == "null" {
+			// empty document
+			continue
+		}
+		// unmarshal the same way cached objects are unmarshaled so that numbers compare equal
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(raw); err != nil {
+			return nil, errors.Wrapf(err, "failed to unmarshal")
+		}
+		if obj.IsList() {
+			err = obj.EachListItem(func(item runtime.Object) error {
+				objs = append(objs, item.(*unstructured.Unstructured))
+				return nil
+			})
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to extract list")
+			}
+			continue
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
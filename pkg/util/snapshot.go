@@ -0,0 +1,112 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SnapshotsDir is the directory under the work dir that holds timestamped snapshots.
+const SnapshotsDir = "snapshots"
+
+// snapshot names are UTC timestamps that sort lexically in time order and are safe to use as directory names
+const snapshotTimeFormat = "20060102T150405Z"
+
+type Snapshot struct {
+	Name string
+	Dir  string
+	Time time.Time
+	Size int64
+}
+
+// NewSnapshotName returns the snapshot name for t.
+func NewSnapshotName(t time.Time) string {
+	return t.UTC().Format(snapshotTimeFormat)
+}
+
+// CreateSnapshotDir creates the directory of a new snapshot named name in workDir, failing if it already exists so that
+// two fetches started within the same second don't write to the same snapshot.
+func CreateSnapshotDir(workDir, name string) (string, error) {
+	dir := filepath.Join(workDir, SnapshotsDir, name)
+	if err := ensureDir(filepath.Dir(dir)); err != nil {
+		return "", err
+	}
+	if err := os.Mkdir(dir, 0751); err != nil {
+		if os.IsExist(err) {
+			return "", errors.Errorf("snapshot %q already exists", name)
+		}
+		return "", errors.Wrapf(err, "failed to create snapshot dir")
+	}
+	return dir, nil
+}
+
+// SnapshotDir returns the directory of the named snapshot, failing if it doesn't exist.
+func SnapshotDir(workDir, name string) (string, error) {
+	if _, err := time.Parse(snapshotTimeFormat, name); err != nil {
+		return "", errors.Errorf("invalid snapshot name %q", name)
+	}
+	dir := filepath.Join(workDir, SnapshotsDir, name)
+	exists, err := fileExists(dir)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to check for snapshot existence")
+	}
+	if !exists {
+		return "", errors.Errorf("snapshot %q not found", name)
+	}
+	return dir, nil
+}
+
+// ListSnapshots returns all snapshots in workDir, oldest first.
+func ListSnapshots(workDir string) ([]*Snapshot, error) {
+	dir := filepath.Join(workDir, SnapshotsDir)
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read snapshots dir")
+	}
+	var snapshots []*Snapshot
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		t, err := time.Parse(snapshotTimeFormat, info.Name())
+		if err != nil {
+			// not ours
+			continue
+		}
+		s := &Snapshot{
+			Name: info.Name(),
+			Dir:  filepath.Join(dir, info.Name()),
+			Time: t,
+		}
+		s.Size, err = dirSize(s.Dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get size of snapshot %q", s.Name)
+		}
+		snapshots = append(snapshots, s)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,111 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestListSnapshots(t *testing.T) {
+	base := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		// dirs and files are created under the snapshots dir unless it is nil
+		dirs  []string
+		files []string
+		want  []string
+	}{
+		{name: "no snapshots dir"},
+		{name: "empty", dirs: []string{}},
+		{
+			name: "oldest first",
+			dirs: []string{
+				NewSnapshotName(base.Add(time.Hour)),
+				NewSnapshotName(base),
+				NewSnapshotName(base.AddDate(0, 0, 1)),
+				NewSnapshotName(base.Add(time.Second)),
+			},
+			want: []string{
+				NewSnapshotName(base),
+				NewSnapshotName(base.Add(time.Second)),
+				NewSnapshotName(base.Add(time.Hour)),
+				NewSnapshotName(base.AddDate(0, 0, 1)),
+			},
+		},
+		{
+			name:  "not ours",
+			dirs:  []string{"other", NewSnapshotName(base)},
+			files: []string{NewSnapshotName(base.Add(time.Hour)), ".mcfetcher.lock"},
+			want:  []string{NewSnapshotName(base)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workDir, err := ioutil.TempDir("", "mcfetcher")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(workDir)
+			dir := filepath.Join(workDir, SnapshotsDir)
+			if tt.dirs != nil {
+				if err := os.Mkdir(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, name := range tt.dirs {
+				if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, name := range tt.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			snapshots, err := ListSnapshots(workDir)
+			if err != nil {
+				t.Fatalf("ListSnapshots() error = %v", err)
+			}
+			var got []string
+			for _, s := range snapshots {
+				got = append(got, s.Name)
+				if s.Dir != filepath.Join(dir, s.Name) {
+					t.Errorf("Dir = %q, want it under %q", s.Dir, dir)
+				}
+				if NewSnapshotName(s.Time) != s.Name {
+					t.Errorf("Time = %v, want the time of %q", s.Time, s.Name)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListSnapshots() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateSnapshotDir(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "mcfetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workDir)
+	name := NewSnapshotName(time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC))
+
+	dir, err := CreateSnapshotDir(workDir, name)
+	if err != nil {
+		t.Fatalf("CreateSnapshotDir() error = %v", err)
+	}
+	if want := filepath.Join(workDir, SnapshotsDir, name); dir != want {
+		t.Errorf("CreateSnapshotDir() = %q, want %q", dir, want)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Errorf("snapshot dir not created: %v", err)
+	}
+	if _, err := CreateSnapshotDir(workDir, name); err == nil {
+		t.Errorf("CreateSnapshotDir() of an existing snapshot error = nil, want an error")
+	}
+}
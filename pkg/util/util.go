@@ -1,6 +1,7 @@
 package util
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -8,12 +9,13 @@ import (
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
@@ -75,7 +77,12 @@ func ReadRawObjects(path string) ([]*unstructured.Unstructured, error) {
 		return nil, errors.Wrapf(err, "failed to open file")
 	}
 	defer file.Close()
-	b, err := ioutil.ReadAll(file)
+	r, err := NewDecompressReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to read file")
 	}
@@ -87,71 +94,116 @@ func ReadRawObjects(path string) ([]*unstructured.Unstructured, error) {
 	return l, nil
 }
 
+// WriteRawObjects writes rawObjects to path, compressed according to the extension of path (see
+// CompressionForPath). ReadRawObjects reads any compression back.
 func WriteRawObjects(path string, rawObjects []*unstructured.Unstructured) error {
 	jsonBytes, err := json.Marshal(rawObjects)
 	if err != nil {
 		return errors.Wrapf(err, "failed to marshal result")
 	}
-	err = ioutil.WriteFile(path, jsonBytes, 0644)
+	var buf bytes.Buffer
+	w, err := NewCompressWriter(&buf, CompressionForPath(path))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create compressor")
+	}
+	if _, err := w.Write(jsonBytes); err != nil {
+		return errors.Wrapf(err, "failed to compress results")
+	}
+	if err := w.Close(); err != nil {
+		return errors.Wrapf(err, "failed to compress results")
+	}
+	err = WriteFileAtomic(path, buf.Bytes(), 0644)
 	if err != nil {
 		return errors.Wrapf(err, "failed to write results")
 	}
 	return nil
 }
 
-// NewLogger returns a *zap.SugaredLogger and a func that should be called with defer.
-// Warnings and above go to stderr. Everything else goes to stdout. All lines are complete Bytes docs.
-func NewLogger() (*zap.SugaredLogger, func()) {
-	// copy and paste of zap.NewExample with parts from zap_test.Example_advancedConfiguration
-	highPriority := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-		return lvl >= zapcore.WarnLevel
-	})
-	lowPriority := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-		return lvl < zapcore.WarnLevel
-	})
-	consoleDebugging := zapcore.Lock(os.Stdout)
-	consoleErrors := zapcore.Lock(os.Stderr)
-	encoderCfg := zapcore.EncoderConfig{
-		MessageKey:     "msg",
-		LevelKey:       "level",
-		NameKey:        "logger",
-		EncodeLevel:    zapcore.LowercaseLevelEncoder,
-		EncodeTime:     zapcore.ISO8601TimeEncoder,
-		EncodeDuration: zapcore.StringDurationEncoder,
-	}
-
-	consoleEncoder := zapcore.NewJSONEncoder((encoderCfg))
-	core := zapcore.NewTee(
-		zapcore.NewCore(consoleEncoder, consoleErrors, highPriority),
-		zapcore.NewCore(consoleEncoder, consoleDebugging, lowPriority),
-	)
-	l := zap.New(core).WithOptions()
-
-	logger := l.Sugar()
-	f := func() {
-		logger.Sync()
-	}
-	return logger, f
-}
-
-func genKey(obj *unstructured.Unstructured) string {
+// CreateTemp creates a temporary file next to path for WriteFileAtomic-style writes. Its name never has the same
+// extension as path so it can't be mistaken for a complete file.
+func CreateTemp(path string) (*os.File, error) {
+	return ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+}
+
+// CommitTemp syncs and closes file, sets perm, and renames it over path. The directory is synced after the rename so
+// that the new file survives a crash. file is removed on failure.
+func CommitTemp(file *os.File, path string, perm os.FileMode) error {
+	err := file.Sync()
+	if err == nil {
+		err = file.Chmod(perm)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return errors.Wrapf(err, "failed to replace %q", path)
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return errors.Wrapf(err, "failed to sync directory of %q", path)
+	}
+	return nil
+}
+
+// syncDir flushes the entries of dir to disk. Windows can't sync directories, so it does nothing there.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// WriteFileAtomic is like ioutil.WriteFile but path is replaced all at once so that a crash or a concurrent reader
+// never sees a partial file.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	file, err := CreateTemp(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create temporary file")
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return errors.Wrapf(err, "failed to write temporary file")
+	}
+	return CommitTemp(file, path, perm)
+}
+
+// ObjectKey returns namespace/name for namespaced objects and name for cluster-scoped objects.
+func ObjectKey(obj *unstructured.Unstructured) string {
 	if len(obj.GetNamespace()) > 0 {
 		return obj.GetNamespace() + "/" + obj.GetName()
 	}
 	return obj.GetName()
 }
 
+// CacheFilename returns the path of the cache file for context and gvkString in workDir without creating anything.
+func CacheFilename(workDir string, context, gvkString, ext string) string {
+	return filepath.Join(workDir, gvkString, fmt.Sprintf("%s.%s", context, ext))
+}
+
+// MkCacheFilename returns CacheFilename after creating its directory.
 func MkCacheFilename(workDir string, context, gvkString, ext string) (string, error) {
-	d := filepath.Join(workDir, gvkString)
-	err := ensureDir(d)
+	filename := CacheFilename(workDir, context, gvkString, ext)
+	err := ensureDir(filepath.Dir(filename))
 	if err != nil {
 		return "", errors.Wrapf(err, "failed to ensure directory")
 	}
-	return filepath.Join(d, fmt.Sprintf("%s.%s", context, ext)), nil
+	return filename, nil
 }
 
-func Sanitize(l *zap.SugaredLogger, obj *unstructured.Unstructured, ignoreNames []*regexp.Regexp, pathValueFilters map[string]*regexp.Regexp, keepAnnotations, keepLabels []*regexp.Regexp, keepPaths, ignorePaths []string, keepDeleted bool) (*unstructured.Unstructured, error) {
-	key := genKey(obj)
+func Sanitize(l *zap.SugaredLogger, obj *unstructured.Unstructured, ignoreNames []*regexp.Regexp, pathValueFilters map[string]*regexp.Regexp, keepAnnotations, ignoreAnnotations, keepLabels, ignoreLabels []*regexp.Regexp, keepPaths, ignorePaths []string, keepDeleted bool) (*unstructured.Unstructured, error) {
+	key := ObjectKey(obj)
 	if matchesAny(key, ignoreNames) {
 		return nil, nil
 	}
@@ -183,7 +235,7 @@ func Sanitize(l *zap.SugaredLogger, obj *unstructured.Unstructured, ignoreNames
 	if obj.GetAnnotations() != nil {
 		sanAnn := map[string]string{}
 		for k, v := range obj.GetAnnotations() {
-			if matchesAny(k, keepAnnotations) {
+			if matchesAny(k, keepAnnotations) && !matchesAny(k, ignoreAnnotations) {
 				sanAnn[k] = v
 			}
 		}
@@ -194,7 +246,7 @@ func Sanitize(l *zap.SugaredLogger, obj *unstructured.Unstructured, ignoreNames
 	if obj.GetLabels() != nil {
 		sanLab := map[string]string{}
 		for k, v := range obj.GetLabels() {
-			if matchesAny(k, keepLabels) {
+			if matchesAny(k, keepLabels) && !matchesAny(k, ignoreLabels) {
 				sanLab[k] = v
 			}
 		}
@@ -233,6 +285,30 @@ func copyNestedField(origObj, newObj map[string]interface{}, fields ...string) (
 	return found, err
 }
 
+// LookupPath returns the value at path in obj. Unlike keep-paths, list items can be addressed by index
+// (e.g. /spec/containers/0/image).
+func LookupPath(obj map[string]interface{}, path string) (interface{}, bool) {
+	var v interface{} = obj
+	for _, segment := range pathToSegments(path) {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = t[segment]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, false
+			}
+			v = t[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
 func pathToSegments(path string) []string {
 	return strings.Split(strings.TrimPrefix(path, "/"), "/")
 }